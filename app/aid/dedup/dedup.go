@@ -0,0 +1,85 @@
+package dedup
+
+import (
+	"crypto/md5"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	EXACT            = "exact"   //内容完全相同视为重复
+	SIMHASH          = "simhash" //SimHash的汉明距离不超过阈值视为重复，即近似重复
+	DEFAULT_DISTANCE = 3
+)
+
+type (
+	//内容去重配置
+	Config struct {
+		Mode     string   //exact（默认）或 simhash
+		Distance int      //simhash 模式下视为重复的最大汉明距离，默认为3
+		Fields   []string //结果数据去重时参与比较的字段，为空时比较全部字段
+	}
+
+	//内容去重过滤器，记录本次任务中见过的内容，并发安全
+	Filter struct {
+		exact map[[16]byte]bool
+		sims  *simIndex
+		sync.Mutex
+	}
+)
+
+var droppedPages, droppedItems uint64
+
+func New(cfg *Config) *Filter {
+	self := &Filter{}
+	if cfg.Mode == SIMHASH {
+		distance := cfg.Distance
+		if distance <= 0 {
+			distance = DEFAULT_DISTANCE
+		}
+		self.sims = newSimIndex(distance)
+	} else {
+		self.exact = make(map[[16]byte]bool)
+	}
+	return self
+}
+
+//内容是否与已见过的内容重复，不重复时记录该内容
+func (self *Filter) Seen(content []byte) bool {
+	if self.sims != nil {
+		return self.sims.seen(SimHash(content))
+	}
+	sum := md5.Sum(content)
+	self.Lock()
+	defer self.Unlock()
+	if self.exact[sum] {
+		return true
+	}
+	self.exact[sum] = true
+	return false
+}
+
+//记录丢弃的重复页面
+func AddDroppedPage() {
+	atomic.AddUint64(&droppedPages, 1)
+}
+
+//记录丢弃的重复结果数据
+func AddDroppedItem() {
+	atomic.AddUint64(&droppedItems, 1)
+}
+
+//本次任务丢弃的重复页面数
+func DroppedPages() uint64 {
+	return atomic.LoadUint64(&droppedPages)
+}
+
+//本次任务丢弃的重复结果数据数
+func DroppedItems() uint64 {
+	return atomic.LoadUint64(&droppedItems)
+}
+
+func ResetDropped() {
+	atomic.StoreUint64(&droppedPages, 0)
+	atomic.StoreUint64(&droppedItems, 0)
+}
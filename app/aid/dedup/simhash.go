@@ -0,0 +1,154 @@
+package dedup
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+//分块索引的最大块数，阈值更大时逐个比较
+const maxBlocks = 16
+
+/**
+  计算文本的64位SimHash
+  忽略HTML标签；字母与数字按词切分，汉字等无空格分词的文字按相邻两字切分，
+  各特征按出现次数加权
+*/
+func SimHash(content []byte) uint64 {
+	var weights [64]int
+	tokenize(content, func(token []byte) {
+		h := fnv.New64a()
+		h.Write(token)
+		sum := h.Sum64()
+		for i := uint(0); i < 64; i++ {
+			if sum&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	})
+	var hash uint64
+	for i, w := range weights {
+		if w > 0 {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+func tokenize(content []byte, emit func([]byte)) {
+	var (
+		word   []byte
+		prev   []byte //上一个汉字
+		inTag  bool
+		buffer = make([]byte, 0, 8)
+	)
+	flush := func() {
+		if len(word) > 0 {
+			emit(word)
+			word = word[:0]
+		}
+	}
+	for len(content) > 0 {
+		r, size := utf8.DecodeRune(content)
+		char := content[:size]
+		content = content[size:]
+
+		switch {
+		case inTag:
+			if r == '>' {
+				inTag = false
+			}
+			continue
+		case r == '<':
+			flush()
+			prev = nil
+			inTag = true
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flush()
+			if prev != nil {
+				buffer = append(append(buffer[:0], prev...), char...)
+				emit(buffer)
+			}
+			prev = char
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			prev = nil
+			word = append(word, []byte(string(unicode.ToLower(r)))...)
+		default:
+			flush()
+			prev = nil
+		}
+	}
+	flush()
+}
+
+/**
+  SimHash近似查找
+  将64位分为 distance+1 块，汉明距离不超过distance的两个值至少有一块完全相同，
+  故只需比较与其某一块相同的已有值
+*/
+type simIndex struct {
+	distance int
+	blocks   []block
+	all      []uint64 //阈值过大而不分块时的全部值
+	sync.Mutex
+}
+
+type block struct {
+	shift uint
+	mask  uint64
+	index map[uint64][]uint64
+}
+
+func newSimIndex(distance int) *simIndex {
+	self := &simIndex{distance: distance}
+	n := distance + 1
+	if n > maxBlocks {
+		return self
+	}
+	var shift uint
+	for i := 0; i < n; i++ {
+		width := uint(64 / n)
+		if i < 64%n {
+			width++
+		}
+		self.blocks = append(self.blocks, block{
+			shift: shift,
+			mask:  1<<width - 1,
+			index: make(map[uint64][]uint64),
+		})
+		shift += width
+	}
+	return self
+}
+
+func (self *simIndex) seen(hash uint64) bool {
+	self.Lock()
+	defer self.Unlock()
+
+	if self.blocks == nil {
+		for _, h := range self.all {
+			if bits.OnesCount64(h^hash) <= self.distance {
+				return true
+			}
+		}
+		self.all = append(self.all, hash)
+		return false
+	}
+
+	for _, b := range self.blocks {
+		for _, h := range b.index[hash>>b.shift&b.mask] {
+			if bits.OnesCount64(h^hash) <= self.distance {
+				return true
+			}
+		}
+	}
+	for _, b := range self.blocks {
+		key := hash >> b.shift & b.mask
+		b.index[key] = append(b.index[key], hash)
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package dedup
+
+import (
+	"math/bits"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		content string
+		want    []string
+	}{
+		{"Hello, World 42", []string{"hello", "world", "42"}},
+		{"<p class=\"x\">Go</p>lang", []string{"go", "lang"}},
+		{"中文分词", []string{"中文", "文分", "分词"}},
+		{"ab中文cd", []string{"ab", "中文", "cd"}},
+		{"中<b>文</b>", nil},
+		{"", nil},
+	}
+	for _, c := range cases {
+		var got []string
+		tokenize([]byte(c.content), func(token []byte) {
+			got = append(got, string(token))
+		})
+		if strings.Join(got, "|") != strings.Join(c.want, "|") {
+			t.Errorf("tokenize(%q) = %q, want %q", c.content, got, c.want)
+		}
+	}
+}
+
+func TestSimHashDistance(t *testing.T) {
+	article := strings.Repeat("The quick brown fox jumps over the lazy dog near the river bank. ", 20)
+	cases := []struct {
+		name string
+		a, b string
+		max  int //汉明距离上限，为负时表示下限
+	}{
+		{"identical", article, article, 0},
+		{"markup ignored", article, "<div><p>" + article + "</p></div>", 0},
+		{"case ignored", article, strings.ToUpper(article), 0},
+		{"small edit", article, article + "Posted yesterday.", 3},
+		{"different text", article, strings.Repeat("Lorem ipsum dolor sit amet consectetur adipiscing elit sed do. ", 20), -10},
+		{"chinese small edit", strings.Repeat("今天天气很好我们一起去公园散步吧", 10), strings.Repeat("今天天气很好我们一起去公园散步吧", 10) + "好的", 3},
+	}
+	for _, c := range cases {
+		d := bits.OnesCount64(SimHash([]byte(c.a)) ^ SimHash([]byte(c.b)))
+		if (c.max >= 0 && d > c.max) || (c.max < 0 && d < -c.max) {
+			t.Errorf("%s: distance = %d, limit %d", c.name, d, c.max)
+		}
+	}
+}
+
+//分块索引与逐个比较的结果一致
+func TestSimIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, distance := range []int{0, 1, 3, 6, maxBlocks - 1, maxBlocks + 4} {
+		idx := newSimIndex(distance)
+		var all []uint64
+		for i := 0; i < 2000; i++ {
+			var hash uint64
+			if len(all) > 0 && i%2 == 0 {
+				//在已有值上翻转若干位，覆盖阈值两侧
+				hash = all[r.Intn(len(all))]
+				for _, p := range r.Perm(64)[:r.Intn(distance+3)] {
+					hash ^= 1 << uint(p)
+				}
+			} else {
+				hash = r.Uint64()
+			}
+			want := false
+			for _, h := range all {
+				if bits.OnesCount64(h^hash) <= distance {
+					want = true
+					break
+				}
+			}
+			if got := idx.seen(hash); got != want {
+				t.Fatalf("distance %d: seen(%016x) = %v, want %v", distance, hash, got, want)
+			}
+			if !want {
+				all = append(all, hash)
+			}
+		}
+	}
+}
+
+func TestSimIndexBoundary(t *testing.T) {
+	cases := []struct {
+		distance int
+		flip     int
+		want     bool
+	}{
+		{3, 0, true},
+		{3, 3, true},
+		{3, 4, false},
+		{20, 20, true},
+		{20, 21, false},
+	}
+	for _, c := range cases {
+		idx := newSimIndex(c.distance)
+		base := uint64(0x0123456789abcdef)
+		idx.seen(base)
+		hash := base
+		for i := 0; i < c.flip; i++ {
+			hash ^= 1 << uint(i*3%64)
+		}
+		if got := idx.seen(hash); got != c.want {
+			t.Errorf("distance %d, %d bits flipped: seen = %v, want %v", c.distance, c.flip, got, c.want)
+		}
+	}
+}
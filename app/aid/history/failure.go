@@ -1,17 +1,18 @@
 package history
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"os"
 	"sync"
 
+	"gopkg.in/mgo.v2/bson"
+
 	"github.com/henrylee2cn/pholcus/common/mgo"
-	"github.com/henrylee2cn/pholcus/common/mysql"
 	"github.com/henrylee2cn/pholcus/common/pool"
 	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/l-dandelion/gospider/app/aid/sqldb"
 	"github.com/l-dandelion/gospider/app/downloader/request"
+	"github.com/l-dandelion/gospider/app/pipeline/collector/data"
 )
 
 type Failure struct {
@@ -19,6 +20,9 @@ type Failure struct {
 	fileName    string
 	list        map[string]*request.Request
 	inheritable bool
+	saved       map[string]bool //已写入存储的记录，nil表示尚未读取
+	savedFrom   string          //saved对应的存储方式
+	lines       int             //记录文件的行数
 	sync.RWMutex
 }
 
@@ -53,78 +57,175 @@ func (self *Failure) DeleteFailure(req *request.Request) {
 }
 
 /**
-先清空历史记录再更新
+与上次输出的记录对比，只写入新增的、删除已移除的失败记录
+pending中尚待重试的记录视为仍然存在
 */
-func (self *Failure) flush(provider string) (fLen int, err error) {
+func (self *Failure) flush(provider string, pending map[string]bool) (fLen int, err error) {
 	self.RWMutex.Lock()
 	defer self.RWMutex.Unlock()
 
+	if self.saved == nil || self.savedFrom != provider {
+		if err = self.loadSaved(provider); err != nil {
+			return len(self.list), fmt.Errorf(" *     Fail [添加失败记录][%s]: %v 条 [READ] %v\n", provider, len(self.list), err)
+		}
+	}
+
+	put := make(map[string]string)
+	for key, req := range self.list {
+		if !self.saved[key] {
+			put[key] = req.Serialize()
+		}
+	}
+	var del []string
+	for key := range self.saved {
+		if _, ok := self.list[key]; !ok && !pending[key] {
+			del = append(del, key)
+		}
+	}
+	if len(put) == 0 && len(del) == 0 {
+		return
+	}
 	fLen = len(self.list)
 
 	switch provider {
 	case "mgo":
 		if mgo.Error() != nil {
-			err = fmt.Errorf(" *     Fail [添加失败记录][mgo]: %v 条 [ERROR] %v\n", fLen, mgo.Error())
-			return
+			return fLen, fmt.Errorf(" *     Fail [添加失败记录][mgo]: %v 条 [ERROR] %v\n", fLen, mgo.Error())
 		}
-		mgo.Call(func(src pool.Src) error {
+		err = mgo.Call(func(src pool.Src) error {
 			c := src.(*mgo.MgoSrc).DB(config.DB_NAME).C(self.tabName)
-			//删除失败记录文件
-			c.DropCollection()
-			if fLen == 0 {
-				return nil
+			for key, s := range put {
+				if _, err := c.UpsertId(key, bson.M{"_id": key, "failure": s}); err != nil {
+					return err
+				}
 			}
-
-			var docs = []interface{}{}
-			for key, req := range self.list {
-				docs = append(docs, map[string]interface{}{"_id": key, "failure": req.Serialize()})
+			if len(del) > 0 {
+				_, err := c.RemoveAll(bson.M{"_id": bson.M{"$in": del}})
+				return err
 			}
-			c.Insert(docs...)
 			return nil
 		})
-	case "mysql":
-		_, err := mysql.DB()
 		if err != nil {
-			return fLen, fmt.Errorf(" *     Fail [添加失败记录][mysql]: %v 条 [ERROR] %v\n", fLen, err)
-		}
-		table, ok := getWriteMysqlTable(self.tabName)
-		if !ok {
-			table = mysql.New()
-			table.SetTableName(self.tabName).CustomPrimaryKey(`id VARCHAR(255) NOT NULL PRIMARY KEY`).AddColumn(`failure MEDIUMTEXT`)
-			setWriteMysqlTable(self.tabName, table)
-			err = table.Create()
-			if err != nil {
-				return fLen, fmt.Errorf(" *     Fail [添加失败记录][mysql]: %v 条 [CREATE] %v\n", fLen, err)
+			return fLen, fmt.Errorf(" *     Fail [添加失败记录][mgo]: %v 条 [ERROR] %v\n", fLen, err)
+		}
+	case "mysql", "postgres", "sqlite":
+		db, err := sqldb.Get(provider)
+		if err != nil {
+			return fLen, fmt.Errorf(" *     Fail [添加失败记录][%s]: %v 条 [ERROR] %v\n", provider, fLen, err)
+		}
+		if err = self.ensureTable(db); err != nil {
+			return fLen, fmt.Errorf(" *     Fail [添加失败记录][%s]: %v 条 [CREATE] %v\n", provider, fLen, err)
+		}
+		rows := make([][]interface{}, 0, len(put))
+		for key, s := range put {
+			rows = append(rows, []interface{}{key, s})
+		}
+		err = db.Insert(self.tabName, []string{"id", "failure"}, rows, []string{"id"}, []string{"failure"})
+		if err != nil {
+			return fLen, fmt.Errorf(" *     Fail [添加失败记录][%s]: %v 条 [ERROR] %v\n", provider, fLen, err)
+		}
+		keys := make([]interface{}, len(del))
+		for i, key := range del {
+			keys[i] = key
+		}
+		if err = db.Delete(self.tabName, "id", keys); err != nil {
+			return fLen, fmt.Errorf(" *     Fail [添加失败记录][%s]: %v 条 [DELETE] %v\n", provider, fLen, err)
+		}
+	default:
+		lines := make([]string, 0, len(put)+len(del))
+		for key, s := range put {
+			lines = append(lines, putRecord(key, s))
+		}
+		for _, key := range del {
+			lines = append(lines, delRecord(key))
+		}
+		if err = appendRecords(self.fileName, lines); err != nil {
+			return fLen, fmt.Errorf(" *     Fail [添加失败记录]: %v 条 [ERROR] %v\n", fLen, err)
+		}
+		self.lines += len(lines)
+		//待重试的记录已不在list中，以文件本身的内容压缩
+		if needCompact(self.lines, len(self.saved)+len(put)-len(del)) {
+			records := make(map[string]string)
+			_, err := loadRecords(self.fileName, legacyFailure,
+				func(key, value string) { records[key] = value },
+				func(key string) { delete(records, key) },
+			)
+			if err == nil {
+				err = writeRecords(self.fileName, records)
 			}
-		} else {
-			err = table.Truncate()
 			if err != nil {
-				return fLen, fmt.Errorf(" *     Fail [添加失败记录][mysql]: %v 条 [TRUNCATE] %v\n", fLen, err)
+				logs.Log.Error(" *     Fail [压缩失败记录]: %v\n", err)
+			} else {
+				self.lines = len(records)
 			}
 		}
-		for key, req := range self.list {
-			table.AutoInsert([]string{key, req.Serialize()})
-			err = table.FlushInsert()
-			if err != nil {
-				fLen--
+	}
+
+	for key := range put {
+		self.saved[key] = true
+	}
+	for _, key := range del {
+		delete(self.saved, key)
+	}
+	return
+}
+
+//读取存储中已有的失败记录键
+func (self *Failure) loadSaved(provider string) error {
+	saved := make(map[string]bool)
+	switch provider {
+	case "mgo":
+		if mgo.Error() != nil {
+			return mgo.Error()
+		}
+		err := mgo.Call(func(src pool.Src) error {
+			c := src.(*mgo.MgoSrc).DB(config.DB_NAME).C(self.tabName)
+			iter := c.Find(nil).Select(bson.M{"_id": 1}).Iter()
+			var doc bson.M
+			for iter.Next(&doc) {
+				if key, ok := doc["_id"].(string); ok {
+					saved[key] = true
+				}
+				doc = nil
 			}
+			return iter.Close()
+		})
+		if err != nil {
+			return err
+		}
+	case "mysql", "postgres", "sqlite":
+		db, err := sqldb.Get(provider)
+		if err != nil {
+			return err
+		}
+		err = db.Select(self.tabName, []string{"id"}, func(row []string) {
+			saved[row[0]] = true
+		})
+		if err != nil {
+			return err
 		}
 	default:
-		//删除失败记录文件
-		os.Remove(self.fileName)
-		if fLen == 0 {
-			return
+		lines, err := loadRecords(self.fileName, legacyFailure,
+			func(key, _ string) { saved[key] = true },
+			func(key string) { delete(saved, key) },
+		)
+		if err != nil {
+			return err
 		}
-		f, _ := os.OpenFile(self.fileName, os.O_CREATE|os.O_WRONLY, 0777)
-
-		docs := make(map[string]string, len(self.list))
-		for key, req := range self.list {
-			docs[key] = req.Serialize()
-		}
-		b, _ := json.Marshal(docs)
-		b = bytes.Replace(b, []byte(`\u0026`), []byte(`&`), -1)
-		f.Write(b)
-		f.Close()
+		self.lines = lines
 	}
-	return
+	self.saved = saved
+	self.savedFrom = provider
+	return nil
+}
+
+func (self *Failure) ensureTable(db *sqldb.DB) error {
+	return db.Ensure(&sqldb.Table{
+		Name: self.tabName,
+		Columns: []sqldb.Column{
+			{Name: "id", Type: db.KeyText() + " NOT NULL"},
+			{Name: "failure", Type: db.ColumnType(data.TYPE_STRING)},
+		},
+		PrimaryKey: []string{"id"},
+	})
 }
@@ -2,34 +2,37 @@ package history
 
 import (
 	"encoding/json"
-	"io/ioutil"
-	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/henrylee2cn/pholcus/common/mgo"
-	"github.com/henrylee2cn/pholcus/common/mysql"
 	"github.com/henrylee2cn/pholcus/common/pool"
 	"github.com/henrylee2cn/pholcus/common/util"
 	"github.com/henrylee2cn/pholcus/config"
 	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/l-dandelion/gospider/app/aid/sqldb"
 	"github.com/l-dandelion/gospider/app/downloader/request"
 )
 
 type (
 	Historier interface {
+		SetRecrawl(ttl time.Duration)              //设置成功记录的有效期，需在读取成功记录前设置
 		ReadSuccess(provider string, inherit bool) //读取成功记录
-		UpsertSuccess(string) bool
+		UpsertSuccess(string, *Record) bool
 		HasSuccess(string) bool
+		GetSuccess(string) *Record
 		DeleteSuccess(string)
 		FlushSuccess(provider string)
+		SuccessStats() StoreStats
 
 		ReadFailure(provider string, inherit bool)
 		PullFailure() map[string]*request.Request
 		UpsertFailure(*request.Request) bool
 		DeleteFailure(*request.Request)
-		FlushFailure(provider string)
+		FlushFailure(provider string, pending map[string]bool) //pending为尚待重试的失败记录，不予删除
 
 		Empty()
 	}
@@ -65,8 +68,8 @@ func New(name string, subName string) Historier {
 		Success: &Success{
 			tabName:  util.FileNameReplace(successTabName),
 			fileName: successFileName,
-			new:      make(map[string]bool),
-			old:      make(map[string]bool),
+			new:      make(map[string]*Record),
+			old:      newMapStore(),
 		},
 		Failure: &Failure{
 			tabName:  util.FileNameReplace(failureTabName),
@@ -82,65 +85,96 @@ func (self *History) ReadSuccess(provider string, inherit bool) {
 	self.RWMutex.Unlock()
 
 	if !inherit {
-		self.Success.old = make(map[string]bool)
-		self.Success.new = make(map[string]bool)
+		self.Success.old.Close()
+		self.Success.old = newSuccessStore(self.Success.tabName, true)
+		self.Success.new = make(map[string]*Record)
 		self.Success.inheritable = false
 	} else if self.Success.inheritable {
 		return
 	} else {
-		self.Success.old = make(map[string]bool)
-		self.Success.new = make(map[string]bool)
+		self.Success.old.Close()
+		self.Success.old = newSuccessStore(self.Success.tabName, false)
+		self.Success.new = make(map[string]*Record)
 		self.Success.inheritable = true
 	}
+	if self.Success.records != nil {
+		self.Success.records = make(map[string]*Record)
+	}
 
 	switch provider {
 	case "mgo":
-		var docs = map[string]interface{}{}
-		err := mgo.Mgo(&docs, "find", map[string]interface{}{
-			"Database":   config.DB_NAME,
-			"Collection": self.Success.tabName,
+		if mgo.Error() != nil {
+			logs.Log.Error(" *     Fail [读取成功记录][mgo]: %v\n", mgo.Error())
+			return
+		}
+		err := mgo.Call(func(src pool.Src) error {
+			iter := src.(*mgo.MgoSrc).DB(config.DB_NAME).C(self.Success.tabName).Find(nil).Iter()
+			var doc bson.M
+			for iter.Next(&doc) {
+				if key, ok := doc["_id"].(string); ok {
+					self.Success.load(key, docRecord(doc))
+				}
+				doc = nil
+			}
+			return iter.Close()
 		})
 		if err != nil {
 			logs.Log.Error(" * Fail [读取成功记录][mgo]: %v\n", err)
 			return
 		}
-		for _, v := range docs["Docs"].([]interface{}) {
-			self.Success.old[v.(bson.M)["_id"].(string)] = true
-		}
-	case "mysql":
-		_, err := mysql.DB()
+	case "mysql", "postgres", "sqlite":
+		db, err := sqldb.Get(provider)
 		if err != nil {
-			logs.Log.Error(" *     Fail [读取成功记录][mysql]： %v\n", err)
+			logs.Log.Error(" *     Fail [读取成功记录][%s]: %v\n", provider, err)
 			return
 		}
-		table, ok := getReadMysqlTable(self.Success.tabName)
-		if !ok {
-			table = mysql.New().SetTableName(self.Success.tabName)
-			setReadMysqlTable(self.Success.tabName, table)
+		if self.Success.records == nil {
+			err = db.Select(self.Success.tabName, []string{"id"}, func(row []string) {
+				self.Success.load(row[0], nil)
+			})
+		} else if err = db.Ensure(self.Success.table(db)); err == nil {
+			err = db.Select(self.Success.tabName, []string{"id", "time", "etag", "last_modified", "hash"}, func(row []string) {
+				rec := &Record{ETag: row[2], LastModified: row[3], Hash: row[4]}
+				rec.Time, _ = strconv.ParseInt(row[1], 10, 64)
+				self.Success.load(row[0], rec)
+			})
 		}
-		rows, err := table.SelectAll()
 		if err != nil {
+			logs.Log.Error(" *     Fail [读取成功记录][%s]: %v\n", provider, err)
 			return
 		}
-		for rows.Next() {
-			var id string
-			err = rows.Scan(&id)
-			self.Success.old[id] = true
-		}
 	default:
-		f, err := os.Open(self.Success.fileName)
+		lines, err := loadRecords(self.Success.fileName, legacySuccess, func(key, value string) {
+			var rec *Record
+			if value != "" && self.Success.records != nil {
+				rec = &Record{}
+				json.Unmarshal([]byte(value), rec)
+			}
+			self.Success.load(key, rec)
+		}, nil)
 		if err != nil {
+			logs.Log.Error(" *     Fail [读取成功记录]: %v\n", err)
 			return
 		}
-		defer f.Close()
-		b, _ := ioutil.ReadAll(f)
-		if len(b) == 0 {
-			return
-		}
-		b[0] = '{'
-		json.Unmarshal(append(b, '}'), &self.Success.old)
+		self.Success.lines = lines
+	}
+	stats := self.Success.old.Stats()
+	logs.Log.Informational(" *     [读取成功记录]: %v 条 [%v 填充率 %.4f]\n", stats.Count, stats.Kind, stats.FillRatio)
+}
+
+//mgo中的成功记录文档
+func docRecord(doc bson.M) *Record {
+	rec := &Record{}
+	switch t := doc["time"].(type) {
+	case int64:
+		rec.Time = t
+	case int:
+		rec.Time = int64(t)
 	}
-	logs.Log.Informational(" *     [读取成功记录]: %v 条\n", len(self.Success.old))
+	rec.ETag, _ = doc["etag"].(string)
+	rec.LastModified, _ = doc["lastModified"].(string)
+	rec.Hash, _ = doc["hash"].(string)
+	return rec
 }
 
 func (self *History) ReadFailure(provider string, inherit bool) {
@@ -158,7 +192,10 @@ func (self *History) ReadFailure(provider string, inherit bool) {
 		self.Failure.list = make(map[string]*request.Request)
 		self.Failure.inheritable = true
 	}
-	var fLen int
+	var (
+		fLen  int
+		saved = make(map[string]bool)
+	)
 	switch provider {
 	case "mgo":
 		if mgo.Error() != nil {
@@ -166,67 +203,62 @@ func (self *History) ReadFailure(provider string, inherit bool) {
 			return
 		}
 
-		var docs = []interface{}{}
-		mgo.Call(func(src pool.Src) error {
-			c := src.(*mgo.MgoSrc).DB(config.DB_NAME).C(self.Failure.tabName)
-			return c.Find(nil).All(&docs)
-		})
-
-		fLen = len(docs)
-
-		for _, v := range docs {
-			key := v.(bson.M)["_id"].(string)
-			failure := v.(bson.M)["failure"].(string)
-			req, err := request.UnSerialize(failure)
-			if err != nil {
-				continue
+		err := mgo.Call(func(src pool.Src) error {
+			iter := src.(*mgo.MgoSrc).DB(config.DB_NAME).C(self.Failure.tabName).Find(nil).Iter()
+			var doc bson.M
+			for iter.Next(&doc) {
+				key, _ := doc["_id"].(string)
+				failure, _ := doc["failure"].(string)
+				doc = nil
+				fLen++
+				saved[key] = true
+				req, err := request.UnSerialize(failure)
+				if err != nil {
+					continue
+				}
+				self.Failure.list[key] = req
 			}
-			self.Failure.list[key] = req
-		}
-	case "mysql":
-		_, err := mysql.DB()
+			return iter.Close()
+		})
 		if err != nil {
-			logs.Log.Error(" *     Fail [取出失败记录][mysql]: %v\n", err)
+			logs.Log.Error(" *     Fail [取出失败记录][mgo]: %v\n", err)
 			return
 		}
-		table, ok := getReadMysqlTable(self.Failure.tabName)
-		if !ok {
-			table = mysql.New().SetTableName(self.Failure.tabName)
-			setReadMysqlTable(self.Failure.tabName, table)
-		}
-		rows, err := table.SelectAll()
+	case "mysql", "postgres", "sqlite":
+		db, err := sqldb.Get(provider)
 		if err != nil {
+			logs.Log.Error(" *     Fail [取出失败记录][%s]: %v\n", provider, err)
 			return
 		}
-		for rows.Next() {
-			var key, failure string
-			err = rows.Scan(&key, &failure)
-			req, err := request.UnSerialize(failure)
+		err = db.Select(self.Failure.tabName, []string{"id", "failure"}, func(row []string) {
+			saved[row[0]] = true
+			fLen++
+			req, err := request.UnSerialize(row[1])
 			if err != nil {
-				continue
+				return
 			}
-			self.Failure.list[key] = req
-			fLen++
-		}
-
-	default:
-		f, err := os.Open(self.Failure.fileName)
+			self.Failure.list[row[0]] = req
+		})
 		if err != nil {
+			logs.Log.Error(" *     Fail [取出失败记录][%s]: %v\n", provider, err)
 			return
 		}
-		b, _ := ioutil.ReadAll(f)
-		f.Close()
-
-		if len(b) == 0 {
+	default:
+		records := make(map[string]string)
+		lines, err := loadRecords(self.Failure.fileName, legacyFailure,
+			func(key, value string) { records[key] = value },
+			func(key string) { delete(records, key) },
+		)
+		if err != nil {
+			logs.Log.Error(" *     Fail [取出失败记录]: %v\n", err)
 			return
 		}
+		self.Failure.lines = lines
 
-		docs := map[string]string{}
-		json.Unmarshal(b, &docs)
-
-		fLen = len(docs)
+		fLen = len(records)
 
-		for key, s := range docs {
+		for key, s := range records {
+			saved[key] = true
 			req, err := request.UnSerialize(s)
 			if err != nil {
 				continue
@@ -234,14 +266,20 @@ func (self *History) ReadFailure(provider string, inherit bool) {
 			self.Failure.list[key] = req
 		}
 	}
+	self.Failure.saved = saved
+	self.Failure.savedFrom = provider
 
 	logs.Log.Informational(" *     [取出失败记录]: %v 条\n", fLen)
 }
 
 func (self *History) Empty() {
 	self.RWMutex.Lock()
-	self.Success.new = make(map[string]bool)
-	self.Success.old = make(map[string]bool)
+	self.Success.new = make(map[string]*Record)
+	if self.Success.records != nil {
+		self.Success.records = make(map[string]*Record)
+	}
+	self.Success.old.Close()
+	self.Success.old = newSuccessStore(self.Success.tabName, true)
 	self.Failure.list = make(map[string]*request.Request)
 	self.RWMutex.Unlock()
 }
@@ -257,15 +295,16 @@ func (self *History) FlushSuccess(provider string) {
 	if err != nil {
 		logs.Log.Error("%v", err)
 	} else {
-		logs.Log.Informational(" *     [输出成功记录]: %v 条\n", sucLen)
+		stats := self.Success.SuccessStats()
+		logs.Log.Informational(" *     [输出成功记录]: %v 条 [%v 共 %v 条，填充率 %.4f]\n", sucLen, stats.Kind, stats.Count, stats.FillRatio)
 	}
 }
 
-func (self *History) FlushFailure(provider string) {
+func (self *History) FlushFailure(provider string, pending map[string]bool) {
 	self.RWMutex.Lock()
 	self.provider = provider
 	self.RWMutex.Unlock()
-	failLen, err := self.Failure.flush(provider)
+	failLen, err := self.Failure.flush(provider, pending)
 	if failLen <= 0 {
 		return
 	}
@@ -275,45 +314,3 @@ func (self *History) FlushFailure(provider string) {
 		logs.Log.Informational(" *     [输出失败记录]: %v 条\n", failLen)
 	}
 }
-
-var (
-	readMysqlTable     = map[string]*mysql.MyTable{}
-	readMysqlTableLock sync.RWMutex
-)
-
-func getReadMysqlTable(name string) (*mysql.MyTable, bool) {
-	readMysqlTableLock.RLock()
-	tab, ok := readMysqlTable[name]
-	readMysqlTableLock.RUnlock()
-	if ok {
-		return tab.Clone(), true
-	}
-	return nil, false
-}
-
-func setReadMysqlTable(name string, tab *mysql.MyTable) {
-	readMysqlTableLock.Lock()
-	readMysqlTable[name] = tab
-	readMysqlTableLock.Unlock()
-}
-
-var (
-	writeMysqlTable     = map[string]*mysql.MyTable{}
-	writeMysqlTableLock sync.RWMutex
-)
-
-func getWriteMysqlTable(name string) (*mysql.MyTable, bool) {
-	writeMysqlTableLock.RLock()
-	tab, ok := writeMysqlTable[name]
-	writeMysqlTableLock.RUnlock()
-	if ok {
-		return tab.Clone(), true
-	}
-	return nil, false
-}
-
-func setWriteMysqlTable(name string, tab *mysql.MyTable) {
-	writeMysqlTableLock.Lock()
-	writeMysqlTable[name] = tab
-	writeMysqlTableLock.Unlock()
-}
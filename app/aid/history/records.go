@@ -0,0 +1,202 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/**
+  历史记录文件，每行一条记录，只追加不改写
+  "+"开头为写入的记录，键与值之间以制表符分隔；"-"开头为删除的记录键。
+  崩溃时写了一半的末行在读取时忽略、追加前截掉；重复与已删除的记录过多时压缩，
+  压缩先写入临时文件再原子替换，任何时刻都不会丢失已写入的记录。
+*/
+const (
+	recordPut = '+'
+	recordDel = '-'
+	//记录行数超过该值且多于有效记录的两倍时压缩
+	recordCompactMin = 10000
+)
+
+func putRecord(key, value string) string {
+	if value == "" {
+		return string(recordPut) + key
+	}
+	return string(recordPut) + key + "\t" + value
+}
+
+func delRecord(key string) string {
+	return string(recordDel) + key
+}
+
+/**
+  逐行回放记录文件，返回文件中的记录行数
+  旧版的整体JSON格式由legacy解析，并就地转换为按行记录的格式
+*/
+func loadRecords(fileName string, legacy func([]byte) map[string]string, put func(key, value string), del func(key string)) (int, error) {
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if b, _ := r.Peek(1); len(b) == 1 && (b[0] == '{' || b[0] == ',') {
+		all, err := ioutil.ReadAll(r)
+		if err != nil {
+			return 0, err
+		}
+		records := legacy(all)
+		for key, value := range records {
+			put(key, value)
+		}
+		return len(records), writeRecords(fileName, records)
+	}
+
+	var lines int
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			//不以换行结尾的末行为崩溃时写了一半的记录
+			break
+		}
+		if err != nil {
+			return lines, err
+		}
+		lines++
+		line = line[:len(line)-1]
+		if len(line) < 2 {
+			continue
+		}
+		switch line[0] {
+		case recordPut:
+			kv := strings.SplitN(line[1:], "\t", 2)
+			if len(kv) == 2 {
+				put(kv[0], kv[1])
+			} else {
+				put(kv[0], "")
+			}
+		case recordDel:
+			if del != nil {
+				del(line[1:])
+			}
+		}
+	}
+	return lines, nil
+}
+
+//追加记录，写入后同步到磁盘
+func appendRecords(fileName string, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0777); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0777)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = dropPartial(f); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	if _, err = f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+//截掉上次崩溃时写了一半的末行
+func dropPartial(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	end := info.Size()
+	buf := make([]byte, 4096)
+	for pos := end; pos > 0; {
+		n := int64(len(buf))
+		if n > pos {
+			n = pos
+		}
+		pos -= n
+		if _, err = f.ReadAt(buf[:n], pos); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			if pos+int64(i)+1 == end {
+				return nil
+			}
+			return f.Truncate(pos + int64(i) + 1)
+		}
+	}
+	if end == 0 {
+		return nil
+	}
+	return f.Truncate(0)
+}
+
+//以有效记录重写文件，原子替换
+func writeRecords(fileName string, records map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0777); err != nil {
+		return err
+	}
+	tmpName := fileName + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0777)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for key, value := range records {
+		w.WriteString(putRecord(key, value))
+		w.WriteByte('\n')
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+func needCompact(lines, count int) bool {
+	return lines > recordCompactMin && lines > 2*count
+}
+
+//旧版成功记录文件：逗号开头、不含外层括号的JSON对象片段
+func legacySuccess(b []byte) map[string]string {
+	b[0] = '{'
+	var docs = map[string]bool{}
+	json.Unmarshal(append(b, '}'), &docs)
+	records := make(map[string]string, len(docs))
+	for key := range docs {
+		records[key] = ""
+	}
+	return records
+}
+
+//旧版失败记录文件：[reqUnique]序列化请求的JSON对象
+func legacyFailure(b []byte) map[string]string {
+	var docs = map[string]string{}
+	json.Unmarshal(b, &docs)
+	return docs
+}
@@ -0,0 +1,181 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//回放记录文件，返回有效记录与行数
+func load(t *testing.T, fileName string, legacy func([]byte) map[string]string) (map[string]string, int) {
+	records := make(map[string]string)
+	lines, err := loadRecords(fileName, legacy,
+		func(key, value string) { records[key] = value },
+		func(key string) { delete(records, key) })
+	if err != nil {
+		t.Fatalf("loadRecords: %v", err)
+	}
+	return records, lines
+}
+
+func TestRecords(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string   //已有的文件内容
+		append  []string //追加的记录
+		want    map[string]string
+		lines   int
+		file    string //追加后的文件内容
+	}{
+		{
+			name:   "new file",
+			append: []string{putRecord("a", ""), putRecord("b", `{"Url":"x"}`)},
+			want:   map[string]string{"a": "", "b": `{"Url":"x"}`},
+			lines:  2,
+			file:   "+a\n+b\t{\"Url\":\"x\"}\n",
+		},
+		{
+			name:    "delete and overwrite",
+			content: "+a\n+b\tv1\n",
+			append:  []string{delRecord("a"), putRecord("b", "v2")},
+			want:    map[string]string{"b": "v2"},
+			lines:   4,
+		},
+		{
+			name:    "value with tabs",
+			content: "+a\tx\ty\n",
+			want:    map[string]string{"a": "x\ty"},
+			lines:   1,
+		},
+		{
+			name:    "partial line ignored",
+			content: "+a\n+b\tv",
+			want:    map[string]string{"a": ""},
+			lines:   1,
+		},
+		{
+			name:    "partial line dropped before append",
+			content: "+a\n+b\tv",
+			append:  []string{putRecord("c", "")},
+			want:    map[string]string{"a": "", "c": ""},
+			lines:   2,
+			file:    "+a\n+c\n",
+		},
+		{
+			name:    "only a partial line",
+			content: "+abc",
+			append:  []string{putRecord("d", "")},
+			want:    map[string]string{"d": ""},
+			lines:   1,
+			file:    "+d\n",
+		},
+		{
+			name:    "empty and unknown lines skipped",
+			content: "\n+\n?x\n+a\n",
+			want:    map[string]string{"a": ""},
+			lines:   4,
+		},
+	}
+	for _, c := range cases {
+		fileName := filepath.Join(t.TempDir(), "sub", "spider")
+		if c.content != "" {
+			os.MkdirAll(filepath.Dir(fileName), 0777)
+			if err := ioutil.WriteFile(fileName, []byte(c.content), 0777); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := appendRecords(fileName, c.append); err != nil {
+			t.Fatalf("%s: appendRecords: %v", c.name, err)
+		}
+		records, lines := load(t, fileName, legacyFailure)
+		if !reflect.DeepEqual(records, c.want) || lines != c.lines {
+			t.Errorf("%s: loaded %v in %d lines, want %v in %d", c.name, records, lines, c.want, c.lines)
+		}
+		if c.file != "" {
+			if b, _ := ioutil.ReadFile(fileName); string(b) != c.file {
+				t.Errorf("%s: file = %q, want %q", c.name, b, c.file)
+			}
+		}
+	}
+}
+
+func TestDropPartial(t *testing.T) {
+	long := make([]byte, 10000)
+	for i := range long {
+		long[i] = 'x'
+	}
+	cases := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", ""},
+		{"complete", "+a\n+b\n", "+a\n+b\n"},
+		{"partial", "+a\n+b", "+a\n"},
+		{"no newline", "+ab", ""},
+		//末行跨越多个读取块
+		{"long partial", "+a\n" + string(long), "+a\n"},
+		{"long complete", "+" + string(long) + "\n+b", "+" + string(long) + "\n"},
+	}
+	for _, c := range cases {
+		fileName := filepath.Join(t.TempDir(), "records")
+		if err := ioutil.WriteFile(fileName, []byte(c.content), 0777); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.OpenFile(fileName, os.O_RDWR, 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = dropPartial(f); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		f.Close()
+		if b, _ := ioutil.ReadFile(fileName); string(b) != c.want {
+			t.Errorf("%s: file = %d bytes, want %d", c.name, len(b), len(c.want))
+		}
+	}
+}
+
+func TestLegacyRecords(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		legacy  func([]byte) map[string]string
+		want    map[string]string
+	}{
+		{"success", `,"a":true,"b":true`, legacySuccess, map[string]string{"a": "", "b": ""}},
+		{"failure", `{"a":"{\"Url\":\"x\"}"}`, legacyFailure, map[string]string{"a": `{"Url":"x"}`}},
+	}
+	for _, c := range cases {
+		fileName := filepath.Join(t.TempDir(), "spider")
+		if err := ioutil.WriteFile(fileName, []byte(c.content), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if records, _ := load(t, fileName, c.legacy); !reflect.DeepEqual(records, c.want) {
+			t.Errorf("%s: loaded %v, want %v", c.name, records, c.want)
+		}
+		//已就地转换为按行记录的格式
+		if records, lines := load(t, fileName, nil); !reflect.DeepEqual(records, c.want) || lines != len(c.want) {
+			t.Errorf("%s: converted file has %v in %d lines", c.name, records, lines)
+		}
+	}
+}
+
+func TestNeedCompact(t *testing.T) {
+	cases := []struct {
+		lines, count int
+		want         bool
+	}{
+		{recordCompactMin, 0, false},
+		{recordCompactMin + 1, 0, true},
+		{recordCompactMin + 1, recordCompactMin, false},
+		{3 * recordCompactMin, recordCompactMin, true},
+	}
+	for _, c := range cases {
+		if got := needCompact(c.lines, c.count); got != c.want {
+			t.Errorf("needCompact(%d, %d) = %v, want %v", c.lines, c.count, got, c.want)
+		}
+	}
+}
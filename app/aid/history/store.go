@@ -0,0 +1,133 @@
+package history
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"path/filepath"
+	"sync"
+
+	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+type (
+	//成功记录的去重存储
+	SuccessStore interface {
+		Has(reqUnique string) bool
+		Add(reqUnique string)
+		Len() int
+		Stats() StoreStats
+		Close()
+	}
+
+	StoreStats struct {
+		Kind          string  //存储类型
+		Count         int     //已记录数量
+		FillRatio     float64 //填充率（布隆过滤器为置位比例，磁盘存储为槽位占用比例）
+		FalsePositive float64 //估算的误判率，仅布隆过滤器有效
+	}
+
+	StoreConfig struct {
+		Kind          string  //map（默认，全部驻留内存）、bloom（布隆过滤器，内存固定）、disk（磁盘哈希表）
+		Capacity      uint64  //预计记录数，用于布隆过滤器与磁盘哈希表的初始容量
+		FalsePositive float64 //布隆过滤器的目标误判率
+		Dir           string  //磁盘存储目录
+	}
+)
+
+const (
+	STORE_MAP   = "map"
+	STORE_BLOOM = "bloom"
+	STORE_DISK  = "disk"
+)
+
+var (
+	storeConfig = StoreConfig{
+		Kind:          STORE_MAP,
+		Capacity:      1 << 20,
+		FalsePositive: 0.0001,
+		Dir:           config.HISTORY_DIR,
+	}
+	storeConfigLock sync.RWMutex
+)
+
+//设置成功记录的去重存储方式，对之后创建的History生效
+func SetSuccessStore(cfg StoreConfig) {
+	storeConfigLock.Lock()
+	defer storeConfigLock.Unlock()
+	if cfg.Kind == "" {
+		cfg.Kind = STORE_MAP
+	}
+	if cfg.Capacity == 0 {
+		cfg.Capacity = storeConfig.Capacity
+	}
+	if cfg.FalsePositive <= 0 || cfg.FalsePositive >= 1 {
+		cfg.FalsePositive = storeConfig.FalsePositive
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = storeConfig.Dir
+	}
+	storeConfig = cfg
+}
+
+//按当前配置创建去重存储，reset为true时清空磁盘中已有的记录
+func newSuccessStore(name string, reset bool) SuccessStore {
+	storeConfigLock.RLock()
+	cfg := storeConfig
+	storeConfigLock.RUnlock()
+
+	switch cfg.Kind {
+	case STORE_BLOOM:
+		return newBloomStore(cfg.Capacity, cfg.FalsePositive)
+	case STORE_DISK:
+		s, err := newDiskStore(filepath.Join(cfg.Dir, name+".dedup"), cfg.Capacity, reset)
+		if err == nil {
+			return s
+		}
+		logs.Log.Error(" *     Fail [成功记录磁盘存储][%v]: %v，改用内存存储\n", name, err)
+	}
+	return newMapStore()
+}
+
+//将请求ID转为16字节，请求ID本身为md5十六进制串时直接解码
+func keyBytes(reqUnique string) (b [16]byte) {
+	if len(reqUnique) == 32 {
+		if _, err := hex.Decode(b[:], []byte(reqUnique)); err == nil {
+			return
+		}
+	}
+	return md5.Sum([]byte(reqUnique))
+}
+
+type mapStore struct {
+	m map[string]bool
+	sync.RWMutex
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{m: make(map[string]bool)}
+}
+
+func (self *mapStore) Has(reqUnique string) bool {
+	self.RLock()
+	defer self.RUnlock()
+	return self.m[reqUnique]
+}
+
+func (self *mapStore) Add(reqUnique string) {
+	self.Lock()
+	self.m[reqUnique] = true
+	self.Unlock()
+}
+
+func (self *mapStore) Len() int {
+	self.RLock()
+	defer self.RUnlock()
+	return len(self.m)
+}
+
+func (self *mapStore) Stats() StoreStats {
+	return StoreStats{Kind: STORE_MAP, Count: self.Len(), FillRatio: 1}
+}
+
+func (self *mapStore) Close() {}
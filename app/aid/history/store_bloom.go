@@ -0,0 +1,93 @@
+package history
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+//布隆过滤器，内存占用由预计容量与误判率决定，不支持删除
+type bloomStore struct {
+	bits  []uint64
+	m     uint64 //位数
+	k     uint64 //哈希函数个数
+	set   uint64 //已置位数
+	count int
+	sync.RWMutex
+}
+
+func newBloomStore(capacity uint64, falsePositive float64) *bloomStore {
+	n := float64(capacity)
+	m := uint64(math.Ceil(-n * math.Log(falsePositive) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomStore{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+//双重哈希：第i个位置为 h1 + i*h2
+func (self *bloomStore) positions(reqUnique string) (h1, h2 uint64) {
+	b := keyBytes(reqUnique)
+	h1 = binary.BigEndian.Uint64(b[:8])
+	h2 = binary.BigEndian.Uint64(b[8:]) | 1
+	return
+}
+
+func (self *bloomStore) Has(reqUnique string) bool {
+	h1, h2 := self.positions(reqUnique)
+	self.RLock()
+	defer self.RUnlock()
+	for i := uint64(0); i < self.k; i++ {
+		pos := (h1 + i*h2) % self.m
+		if self.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (self *bloomStore) Add(reqUnique string) {
+	h1, h2 := self.positions(reqUnique)
+	self.Lock()
+	defer self.Unlock()
+	var added bool
+	for i := uint64(0); i < self.k; i++ {
+		pos := (h1 + i*h2) % self.m
+		if self.bits[pos/64]&(1<<(pos%64)) == 0 {
+			self.bits[pos/64] |= 1 << (pos % 64)
+			self.set++
+			added = true
+		}
+	}
+	if added {
+		self.count++
+	}
+}
+
+func (self *bloomStore) Len() int {
+	self.RLock()
+	defer self.RUnlock()
+	return self.count
+}
+
+func (self *bloomStore) Stats() StoreStats {
+	self.RLock()
+	defer self.RUnlock()
+	fill := float64(self.set) / float64(self.m)
+	return StoreStats{
+		Kind:          STORE_BLOOM,
+		Count:         self.count,
+		FillRatio:     fill,
+		FalsePositive: math.Pow(fill, float64(self.k)),
+	}
+}
+
+func (self *bloomStore) Close() {}
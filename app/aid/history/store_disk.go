@@ -0,0 +1,216 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	diskSlotSize = 16
+	diskMaxLoad  = 0.7
+)
+
+/**
+  磁盘哈希表，每条记录占16字节的槽位，开放寻址、线性探测
+  内存中只保留计数，查询依赖系统页缓存；填充率超过diskMaxLoad时扩容一倍
+*/
+type diskStore struct {
+	fileName string
+	file     *os.File
+	slots    uint64
+	count    int
+	sync.RWMutex
+}
+
+var zeroSlot [diskSlotSize]byte
+
+func newDiskStore(fileName string, capacity uint64, reset bool) (*diskStore, error) {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0777); err != nil {
+		return nil, err
+	}
+	if reset {
+		os.Remove(fileName)
+	}
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0777)
+	if err != nil {
+		return nil, err
+	}
+	self := &diskStore{
+		fileName: fileName,
+		file:     f,
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.Size() == 0 {
+		self.slots = uint64(float64(capacity)/diskMaxLoad) + 1
+		err = f.Truncate(int64(self.slots * diskSlotSize))
+	} else {
+		self.slots = uint64(info.Size()) / diskSlotSize
+		err = self.recount()
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return self, nil
+}
+
+func (self *diskStore) recount() error {
+	buf := make([]byte, diskSlotSize*4096)
+	var off int64
+	for {
+		n, err := self.file.ReadAt(buf, off)
+		for i := 0; i+diskSlotSize <= n; i += diskSlotSize {
+			if !bytes.Equal(buf[i:i+diskSlotSize], zeroSlot[:]) {
+				self.count++
+			}
+		}
+		off += int64(n)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+//查找key所在或应插入的槽位
+func (self *diskStore) probe(f *os.File, slots uint64, key [16]byte) (slot uint64, found bool, err error) {
+	var buf [diskSlotSize]byte
+	slot = binary.BigEndian.Uint64(key[:8]) % slots
+	for i := uint64(0); i < slots; i++ {
+		if _, err = f.ReadAt(buf[:], int64(slot*diskSlotSize)); err != nil {
+			return
+		}
+		if buf == zeroSlot {
+			return slot, false, nil
+		}
+		if buf == key {
+			return slot, true, nil
+		}
+		slot = (slot + 1) % slots
+	}
+	return slot, false, io.ErrShortBuffer
+}
+
+func (self *diskStore) Has(reqUnique string) bool {
+	self.RLock()
+	defer self.RUnlock()
+	if self.file == nil {
+		return false
+	}
+	_, found, _ := self.probe(self.file, self.slots, keyBytes(reqUnique))
+	return found
+}
+
+func (self *diskStore) Add(reqUnique string) {
+	self.Lock()
+	defer self.Unlock()
+	if self.file == nil {
+		return
+	}
+	if float64(self.count+1) > float64(self.slots)*diskMaxLoad {
+		if err := self.grow(); err != nil {
+			return
+		}
+	}
+	key := keyBytes(reqUnique)
+	slot, found, err := self.probe(self.file, self.slots, key)
+	if err != nil || found {
+		return
+	}
+	if _, err = self.file.WriteAt(key[:], int64(slot*diskSlotSize)); err == nil {
+		self.count++
+	}
+}
+
+//扩容一倍，重新散列到新文件后替换
+func (self *diskStore) grow() error {
+	tmpName := self.fileName + ".tmp"
+	tmp, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0777)
+	if err != nil {
+		return err
+	}
+	slots := self.slots * 2
+	if err = tmp.Truncate(int64(slots * diskSlotSize)); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	buf := make([]byte, diskSlotSize*4096)
+	var off int64
+	for {
+		n, rerr := self.file.ReadAt(buf, off)
+		for i := 0; i+diskSlotSize <= n; i += diskSlotSize {
+			var key [16]byte
+			copy(key[:], buf[i:i+diskSlotSize])
+			if key == zeroSlot {
+				continue
+			}
+			slot, _, err := self.probe(tmp, slots, key)
+			if err != nil {
+				tmp.Close()
+				return err
+			}
+			if _, err = tmp.WriteAt(key[:], int64(slot*diskSlotSize)); err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+		off += int64(n)
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			tmp.Close()
+			return rerr
+		}
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = os.Rename(tmpName, self.fileName); err != nil {
+		tmp.Close()
+		return err
+	}
+	self.file.Close()
+	self.file = tmp
+	self.slots = slots
+	return nil
+}
+
+func (self *diskStore) Len() int {
+	self.RLock()
+	defer self.RUnlock()
+	return self.count
+}
+
+func (self *diskStore) Stats() StoreStats {
+	self.RLock()
+	defer self.RUnlock()
+	return StoreStats{
+		Kind:      STORE_DISK,
+		Count:     self.count,
+		FillRatio: float64(self.count) / float64(self.slots),
+	}
+}
+
+func (self *diskStore) Close() {
+	self.Lock()
+	defer self.Unlock()
+	if self.file != nil {
+		self.file.Close()
+		self.file = nil
+	}
+}
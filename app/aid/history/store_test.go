@@ -0,0 +1,126 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestBloomFalsePositive(t *testing.T) {
+	cases := []struct {
+		capacity      uint64
+		falsePositive float64
+	}{
+		{1000, 0.01},
+		{10000, 0.001},
+		{5000, 0.0001},
+	}
+	for _, c := range cases {
+		s := newBloomStore(c.capacity, c.falsePositive)
+		for i := uint64(0); i < c.capacity; i++ {
+			s.Add("in" + strconv.FormatUint(i, 10))
+		}
+		for i := uint64(0); i < c.capacity; i++ {
+			if key := "in" + strconv.FormatUint(i, 10); !s.Has(key) {
+				t.Fatalf("%d/%v: added key %s not found", c.capacity, c.falsePositive, key)
+			}
+		}
+
+		//未加入的键按目标误判率误判，允许3倍的统计波动
+		const probes = 200000
+		var fp int
+		for i := 0; i < probes; i++ {
+			if s.Has("out" + strconv.Itoa(i)) {
+				fp++
+			}
+		}
+		rate := float64(fp) / probes
+		if rate > 3*c.falsePositive {
+			t.Errorf("%d/%v: false positive rate %v", c.capacity, c.falsePositive, rate)
+		}
+		stats := s.Stats()
+		if stats.FalsePositive > 3*c.falsePositive {
+			t.Errorf("%d/%v: estimated false positive rate %v", c.capacity, c.falsePositive, stats.FalsePositive)
+		}
+		//重复加入不计数；偶有误判的新键也不计数
+		if stats.Count > int(c.capacity) || stats.Count < int(c.capacity)-int(float64(c.capacity)*3*c.falsePositive)-1 {
+			t.Errorf("%d/%v: count = %d", c.capacity, c.falsePositive, stats.Count)
+		}
+	}
+}
+
+func TestBloomAddTwice(t *testing.T) {
+	s := newBloomStore(100, 0.01)
+	s.Add("a")
+	s.Add("a")
+	if s.Len() != 1 {
+		t.Errorf("Len() = %d after adding the same key twice, want 1", s.Len())
+	}
+}
+
+func TestDiskStoreGrow(t *testing.T) {
+	cases := []struct {
+		capacity uint64
+		n        int
+	}{
+		{100, 50},    //不扩容
+		{10, 100},    //多次扩容
+		{1, 1000},    //从最小容量开始扩容
+		{1000, 1000}, //恰好超过装载上限
+	}
+	for _, c := range cases {
+		fileName := filepath.Join(t.TempDir(), "spider.dedup")
+		s, err := newDiskStore(fileName, c.capacity, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		initial := s.slots
+		for i := 0; i < c.n; i++ {
+			s.Add("key" + strconv.Itoa(i))
+		}
+		s.Add("key0")
+		if s.Len() != c.n {
+			t.Errorf("%d/%d: Len() = %d, want %d", c.capacity, c.n, s.Len(), c.n)
+		}
+		if fill := s.Stats().FillRatio; fill > diskMaxLoad {
+			t.Errorf("%d/%d: fill ratio %v exceeds %v", c.capacity, c.n, fill, diskMaxLoad)
+		}
+		if float64(c.n) > float64(initial)*diskMaxLoad && s.slots <= initial {
+			t.Errorf("%d/%d: store did not grow from %d slots", c.capacity, c.n, initial)
+		}
+		for i := 0; i < c.n; i++ {
+			if key := "key" + strconv.Itoa(i); !s.Has(key) {
+				t.Fatalf("%d/%d: %s lost", c.capacity, c.n, key)
+			}
+		}
+		if s.Has("missing") {
+			t.Errorf("%d/%d: Has(missing) = true", c.capacity, c.n)
+		}
+		slots := s.slots
+		s.Close()
+		if _, err := os.Stat(fileName + ".tmp"); !os.IsNotExist(err) {
+			t.Errorf("%d/%d: temporary file left behind", c.capacity, c.n)
+		}
+
+		//重新打开后记录与容量不变
+		s, err = newDiskStore(fileName, c.capacity, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Len() != c.n || s.slots != slots || !s.Has("key"+strconv.Itoa(c.n-1)) {
+			t.Errorf("%d/%d: reopened with %d records in %d slots, want %d in %d", c.capacity, c.n, s.Len(), s.slots, c.n, slots)
+		}
+		s.Close()
+
+		//reset清空已有记录
+		s, err = newDiskStore(fileName, c.capacity, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Len() != 0 || s.Has("key0") {
+			t.Errorf("%d/%d: reset store still has %d records", c.capacity, c.n, s.Len())
+		}
+		s.Close()
+	}
+}
@@ -3,44 +3,109 @@ package history
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
 
 	"github.com/henrylee2cn/pholcus/common/mgo"
-	"github.com/henrylee2cn/pholcus/common/mysql"
+	"github.com/henrylee2cn/pholcus/common/pool"
 	"github.com/henrylee2cn/pholcus/config"
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/l-dandelion/gospider/app/aid/sqldb"
+	"github.com/l-dandelion/gospider/app/pipeline/collector/data"
+)
+
+type (
+	Success struct {
+		tabName     string
+		fileName    string
+		new         map[string]*Record
+		old         SuccessStore
+		records     map[string]*Record //开启重新采集时的全部记录，常驻内存
+		ttl         time.Duration      //成功记录的有效期，0为永不过期
+		inheritable bool
+		lines       int //记录文件的行数
+		sync.RWMutex
+	}
+
+	//成功记录的采集信息，用于判断记录是否过期及发送条件请求
+	Record struct {
+		Time         int64  `json:"t"`              //采集时间，Unix秒
+		ETag         string `json:"etag,omitempty"` //响应头ETag
+		LastModified string `json:"lm,omitempty"`   //响应头Last-Modified
+		Hash         string `json:"hash,omitempty"` //页面内容的md5
+	}
 )
 
-type Success struct {
-	tabName     string
-	fileName    string
-	new         map[string]bool
-	old         map[string]bool
-	inheritable bool
-	sync.RWMutex
+/**
+设置成功记录的有效期，需在读取成功记录前设置
+大于0时开启重新采集：过期的记录视为不存在，其采集信息用于条件请求
+注意开启后全部记录及其采集信息均保存在内存中，不受bloom、disk等去重存储的容量控制
+*/
+func (self *Success) SetRecrawl(ttl time.Duration) {
+	self.RWMutex.Lock()
+	defer self.RWMutex.Unlock()
+	self.ttl = ttl
+	if ttl > 0 {
+		self.records = make(map[string]*Record)
+	} else {
+		self.records = nil
+	}
 }
 
-func (self *Success) UpsertSuccess(reqUnique string) bool {
+/**
+添加成功记录，rec为nil时仅记录采集时间
+未开启重新采集时，已存在的记录保持不变并返回false；开启时更新其采集信息
+*/
+func (self *Success) UpsertSuccess(reqUnique string, rec *Record) bool {
 	self.RWMutex.Lock()
 	defer self.RWMutex.Unlock()
 
-	if self.old[reqUnique] {
+	if rec == nil {
+		rec = &Record{}
+	}
+	if rec.Time == 0 {
+		rec.Time = time.Now().Unix()
+	}
+
+	if self.records != nil {
+		self.records[reqUnique] = rec
+		self.new[reqUnique] = rec
+		return true
+	}
+
+	if self.old.Has(reqUnique) {
 		return false
 	}
 
-	if self.new[reqUnique] {
+	if self.new[reqUnique] != nil {
 		return false
 	}
 
-	self.new[reqUnique] = true
+	self.new[reqUnique] = rec
 	return true
 }
 
 func (self *Success) HasSuccess(reqUnique string) bool {
 	self.RWMutex.RLock()
-	has := self.old[reqUnique] || self.new[reqUnique]
-	self.RWMutex.RUnlock()
-	return has
+	defer self.RWMutex.RUnlock()
+	if self.records != nil {
+		rec := self.records[reqUnique]
+		return rec != nil && time.Since(time.Unix(rec.Time, 0)) < self.ttl
+	}
+	return self.new[reqUnique] != nil || self.old.Has(reqUnique)
+}
+
+//开启重新采集时返回上次的采集信息，否则返回nil
+func (self *Success) GetSuccess(reqUnique string) *Record {
+	self.RWMutex.RLock()
+	defer self.RWMutex.RUnlock()
+	if rec := self.records[reqUnique]; rec != nil {
+		r := *rec
+		return &r
+	}
+	return nil
 }
 
 func (self *Success) DeleteSuccess(reqUnique string) {
@@ -49,6 +114,36 @@ func (self *Success) DeleteSuccess(reqUnique string) {
 	self.RWMutex.Unlock()
 }
 
+//载入已有的成功记录
+func (self *Success) load(reqUnique string, rec *Record) {
+	self.old.Add(reqUnique)
+	if self.records != nil {
+		if rec == nil {
+			rec = &Record{}
+		}
+		self.records[reqUnique] = rec
+	}
+}
+
+//成功记录在数据库中的表结构
+func (self *Success) table(db *sqldb.DB) *sqldb.Table {
+	return &sqldb.Table{
+		Name: self.tabName,
+		Columns: []sqldb.Column{
+			{Name: "id", Type: db.KeyText() + " NOT NULL"},
+			{Name: "time", Type: db.ColumnType(data.TYPE_INT)},
+			{Name: "etag", Type: db.KeyText()},
+			{Name: "last_modified", Type: db.KeyText()},
+			{Name: "hash", Type: db.KeyText()},
+		},
+		PrimaryKey: []string{"id"},
+	}
+}
+
+/**
+只写入上次输出后新增或更新的成功记录
+写入失败时保留新增记录，下次输出时重试
+*/
 func (self *Success) flush(provider string) (sLen int, err error) {
 	self.RWMutex.Lock()
 	defer self.RWMutex.Unlock()
@@ -61,60 +156,77 @@ func (self *Success) flush(provider string) (sLen int, err error) {
 	switch provider {
 	case "mgo":
 		if mgo.Error() != nil {
-			err = fmt.Errorf(" *     Fail [添加成功记录]【mgo]: %v 条 [ERROR] %v\n", sLen, mgo.Error())
-			return
-		}
-		var docs = make([]map[string]interface{}, sLen)
-		var i int
-		for key := range self.new {
-			docs[i] = map[string]interface{}{"_id": key}
-			self.old[key] = true
-			i++
+			return sLen, fmt.Errorf(" *     Fail [添加成功记录][mgo]: %v 条 [ERROR] %v\n", sLen, mgo.Error())
 		}
-		err = mgo.Mgo(nil, "insert", map[string]interface{}{
-			"Database":    config.DB_NAME,
-			"Collecstion": self.tabName,
-			"Docs":        docs,
+		err = mgo.Call(func(src pool.Src) error {
+			b := src.(*mgo.MgoSrc).DB(config.DB_NAME).C(self.tabName).Bulk()
+			b.Unordered()
+			for key, rec := range self.new {
+				b.Upsert(bson.M{"_id": key}, bson.M{
+					"_id":          key,
+					"time":         rec.Time,
+					"etag":         rec.ETag,
+					"lastModified": rec.LastModified,
+					"hash":         rec.Hash,
+				})
+			}
+			_, err := b.Run()
+			return err
 		})
 		if err != nil {
-			err = fmt.Errorf(" *     Fail [添加成功记录][mgo]: %v 条 [ERROR] %v\n", sLen, err)
+			return sLen, fmt.Errorf(" *     Fail [添加成功记录][mgo]: %v 条 [ERROR] %v\n", sLen, err)
 		}
-	case "mysql":
-		_, err := mysql.DB()
+	case "mysql", "postgres", "sqlite":
+		db, err := sqldb.Get(provider)
 		if err != nil {
-			return sLen, fmt.Errorf(" *     Fail [添加成功记录][mysql]: %v 条 [ERROR] %v\n", sLen, err)
+			return sLen, fmt.Errorf(" *     Fail [添加成功记录][%s]: %v 条 [ERROR] %v\n", provider, sLen, err)
 		}
-		table, ok := getWriteMysqlTable(self.tabName)
-		if !ok {
-			table = mysql.New()
-			table.SetTableName(self.tabName).CustomPrimaryKey(`id VARCHAR(255) NOT NULL PRIMARY KEY`)
-			err = table.Create()
-			if err != nil {
-				return sLen, fmt.Errorf(" *     Fail [添加成功记录][mysql]: %v 条[ERROR] %v\n", sLen, err)
-			}
-			setWriteMysqlTable(self.tabName, table)
+		if err = db.Ensure(self.table(db)); err != nil {
+			return sLen, fmt.Errorf(" *     Fail [添加成功记录][%s]: %v 条 [CREATE] %v\n", provider, sLen, err)
 		}
-		for key := range self.new {
-			table.AutoInsert([]string{key})
-			self.old[key] = true
+		rows := make([][]interface{}, 0, sLen)
+		for key, rec := range self.new {
+			rows = append(rows, []interface{}{key, rec.Time, rec.ETag, rec.LastModified, rec.Hash})
 		}
-		err = table.FlushInsert()
+		//已存在的记录更新其采集信息
+		err = db.Insert(self.tabName, []string{"id", "time", "etag", "last_modified", "hash"}, rows,
+			[]string{"id"}, []string{"time", "etag", "last_modified", "hash"})
 		if err != nil {
-			return sLen, fmt.Errorf(" *     Fail [添加成功记录][mysql]: %v 条 [ERROR] %v\n", sLen, err)
+			return sLen, fmt.Errorf(" *     Fail [添加成功记录][%s]: %v 条 [ERROR] %v\n", provider, sLen, err)
 		}
 	default:
-		f, _ := os.OpenFile(self.fileName, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0777)
-
-		b, _ := json.Marshal(self.new)
-
-		b[0] = ','
-		f.Write(b[:len(b)-1])
-		f.Close()
-
-		for key := range self.new {
-			self.old[key] = true
+		lines := make([]string, 0, sLen)
+		for key, rec := range self.new {
+			b, _ := json.Marshal(rec)
+			lines = append(lines, putRecord(key, string(b)))
+		}
+		if err = appendRecords(self.fileName, lines); err != nil {
+			return sLen, fmt.Errorf(" *     Fail [添加成功记录]: %v 条 [ERROR] %v\n", sLen, err)
+		}
+		self.lines += len(lines)
+		//开启重新采集时，每次重新采集都会为同一记录追加一行
+		if self.records != nil && needCompact(self.lines, len(self.records)) {
+			records := make(map[string]string, len(self.records))
+			for key, rec := range self.records {
+				b, _ := json.Marshal(rec)
+				records[key] = string(b)
+			}
+			if err := writeRecords(self.fileName, records); err != nil {
+				logs.Log.Error(" *     Fail [压缩成功记录]: %v\n", err)
+			} else {
+				self.lines = len(records)
+			}
 		}
 	}
-	self.new = make(map[string]bool)
+	for key := range self.new {
+		self.old.Add(key)
+	}
+	self.new = make(map[string]*Record)
 	return
 }
+
+func (self *Success) SuccessStats() StoreStats {
+	self.RWMutex.RLock()
+	defer self.RWMutex.RUnlock()
+	return self.old.Stats()
+}
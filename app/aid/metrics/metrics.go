@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gospider"
+
+var (
+	//下载耗时，按主机统计
+	downloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_duration_seconds",
+		Help:      "Download latency by host.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"host"})
+
+	//下载结果，code为响应状态码，下载出错时为error
+	downloadResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_responses_total",
+		Help:      "Download results by host and status code.",
+	}, []string{"host", "code"})
+
+	//下载重试次数
+	downloadRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_retries_total",
+		Help:      "HTTP retries inside the surfer by host.",
+	}, []string{"host"})
+
+	//队列中的请求数
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Requests waiting in the scheduler queue by spider and keyin.",
+	}, []string{"spider", "keyin"})
+
+	//队列中各优先级的请求数
+	queuePriority = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_priority_requests",
+		Help:      "Requests waiting in the scheduler queue by spider, keyin and priority.",
+	}, []string{"spider", "keyin", "priority"})
+
+	//因已有记录而被丢弃的请求数
+	dedupHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dedup_hits_total",
+		Help:      "Requests dropped because they were already seen.",
+	}, []string{"spider"})
+
+	//因内容重复而被丢弃的页面与结果数据数，kind为page或item
+	duplicatesDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicates_dropped_total",
+		Help:      "Pages and items dropped as content duplicates.",
+	}, []string{"spider", "kind"})
+
+	//代理IP的分配次数，未分配到代理时proxy为none
+	proxySelections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proxy_selections_total",
+		Help:      "Proxy selections by proxy address.",
+	}, []string{"proxy"})
+
+	//代理被隔离的次数，reason为failed或banned
+	proxyQuarantines = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proxy_quarantines_total",
+		Help:      "Proxies quarantined by proxy address and reason.",
+	}, []string{"proxy", "reason"})
+
+	//每批输出的数据条数
+	outputBatchSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "output_batch_size",
+		Help:      "Items per collector output batch.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 10),
+	}, []string{"spider", "out_type"})
+
+	//输出失败的批次数
+	outputErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "output_errors_total",
+		Help:      "Failed collector output batches.",
+	}, []string{"spider", "out_type"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		downloadDuration,
+		downloadResponses,
+		downloadRetries,
+		queueDepth,
+		queuePriority,
+		dedupHits,
+		duplicatesDropped,
+		proxySelections,
+		proxyQuarantines,
+		outputBatchSize,
+		outputErrors,
+	)
+}
+
+//以Prometheus文本格式输出全部指标
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+//记录一次下载，statusCode为0表示下载出错
+func ObserveDownload(host string, statusCode int, took time.Duration) {
+	code := "error"
+	if statusCode > 0 {
+		code = strconv.Itoa(statusCode)
+	}
+	downloadDuration.WithLabelValues(host).Observe(took.Seconds())
+	downloadResponses.WithLabelValues(host, code).Inc()
+}
+
+func IncRetry(host string) {
+	downloadRetries.WithLabelValues(host).Inc()
+}
+
+//队列中的请求数变化，delta为正表示入队，为负表示出队
+func AddQueue(spiderName, subName string, priority int, delta int) {
+	queueDepth.WithLabelValues(spiderName, subName).Add(float64(delta))
+	queuePriority.WithLabelValues(spiderName, subName, strconv.Itoa(priority)).Add(float64(delta))
+}
+
+//清除蜘蛛的队列指标，同一蜘蛛的不同自定义配置各自独立
+func ResetQueue(spiderName, subName string, priorities []int) {
+	queueDepth.DeleteLabelValues(spiderName, subName)
+	for _, priority := range priorities {
+		queuePriority.DeleteLabelValues(spiderName, subName, strconv.Itoa(priority))
+	}
+}
+
+func IncDedupHit(spiderName string) {
+	dedupHits.WithLabelValues(spiderName).Inc()
+}
+
+//kind为page或item
+func IncDuplicate(spiderName, kind string) {
+	duplicatesDropped.WithLabelValues(spiderName, kind).Inc()
+}
+
+func IncProxySelection(proxy string) {
+	if proxy == "" {
+		proxy = "none"
+	}
+	proxySelections.WithLabelValues(proxy).Inc()
+}
+
+//reason为failed或banned
+func IncProxyQuarantine(proxy, reason string) {
+	proxyQuarantines.WithLabelValues(proxy, reason).Inc()
+}
+
+//记录一批数据输出，err不为nil时计为失败
+func ObserveOutput(spiderName, outType string, size int, err error) {
+	outputBatchSize.WithLabelValues(spiderName, outType).Observe(float64(size))
+	if err != nil {
+		outputErrors.WithLabelValues(spiderName, outType).Inc()
+	}
+}
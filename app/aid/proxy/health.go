@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+)
+
+//代理的一次使用结果
+type Outcome int
+
+const (
+	GOOD   Outcome = iota //请求成功
+	FAILED                //连接失败、超时或代理服务器出错
+	BANNED                //被目标站点封禁，如403、429或验证码页面
+)
+
+const (
+	//连续失败该次数后隔离代理
+	MAX_FAILS = 3
+	//连续成功该次数后重置隔离时长
+	RESET_SUCCESSES = 10
+	//隔离时长，每次隔离翻倍，直至上限
+	MIN_BACKOFF = time.Minute
+	MAX_BACKOFF = time.Hour
+	//评分低于该值时优先换用其他代理
+	MIN_SCORE = 0.5
+	//评分的平滑系数，越大越看重最近的结果
+	SCORE_ALPHA = 0.2
+)
+
+/**
+  根据下载结果判断代理的状态
+  banned为页面中含有封禁标志，如验证码页面
+*/
+func Judge(statusCode int, err error, banned bool) Outcome {
+	switch {
+	case banned, statusCode == http.StatusForbidden, statusCode == http.StatusTooManyRequests:
+		return BANNED
+	case statusCode == http.StatusProxyAuthRequired,
+		statusCode == http.StatusBadGateway,
+		statusCode == http.StatusGatewayTimeout:
+		return FAILED
+	case err != nil && statusCode == 0:
+		return FAILED
+	}
+	return GOOD
+}
+
+func (self Outcome) String() string {
+	switch self {
+	case FAILED:
+		return "failed"
+	case BANNED:
+		return "banned"
+	}
+	return "good"
+}
+
+//代理对某一主机的健康状况
+type health struct {
+	score     float64       //近期成功率的指数移动平均，初始为1
+	fails     int           //连续失败次数
+	successes int           //连续成功次数
+	backoff   time.Duration //上次隔离的时长
+	until     time.Time     //隔离截止时间
+	testing   bool          //隔离期满，正在后台重新测试
+}
+
+func newHealth() *health {
+	return &health{score: 1}
+}
+
+//未被隔离时可以使用
+func (self *health) usable(now time.Time) bool {
+	return !self.testing && !now.Before(self.until)
+}
+
+//记录一次使用结果，需要隔离时返回true
+func (self *health) report(outcome Outcome) bool {
+	if outcome == GOOD {
+		self.score += SCORE_ALPHA * (1 - self.score)
+		self.fails = 0
+		if self.successes++; self.successes >= RESET_SUCCESSES {
+			self.backoff = 0
+		}
+		return false
+	}
+	self.score -= SCORE_ALPHA * self.score
+	self.successes = 0
+	self.fails++
+	return outcome == BANNED || self.fails >= MAX_FAILS
+}
+
+//隔离代理，返回本次的隔离时长
+func (self *health) quarantine(now time.Time) time.Duration {
+	self.backoff *= 2
+	if self.backoff < MIN_BACKOFF {
+		self.backoff = MIN_BACKOFF
+	} else if self.backoff > MAX_BACKOFF {
+		self.backoff = MAX_BACKOFF
+	}
+	self.fails = 0
+	self.until = now.Add(self.backoff)
+	return self.backoff
+}
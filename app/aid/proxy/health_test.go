@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestJudge(t *testing.T) {
+	cases := []struct {
+		code   int
+		err    error
+		banned bool
+		want   Outcome
+	}{
+		{http.StatusOK, nil, false, GOOD},
+		{http.StatusNotFound, nil, false, GOOD},
+		{http.StatusInternalServerError, nil, false, GOOD},
+		{http.StatusOK, nil, true, BANNED},
+		{http.StatusForbidden, nil, false, BANNED},
+		{http.StatusTooManyRequests, nil, false, BANNED},
+		{http.StatusProxyAuthRequired, nil, false, FAILED},
+		{http.StatusBadGateway, nil, false, FAILED},
+		{http.StatusGatewayTimeout, nil, false, FAILED},
+		{0, errors.New("timeout"), false, FAILED},
+	}
+	for _, c := range cases {
+		if got := Judge(c.code, c.err, c.banned); got != c.want {
+			t.Errorf("Judge(%d, %v, %v) = %v, want %v", c.code, c.err, c.banned, got, c.want)
+		}
+	}
+}
+
+func TestHealthScore(t *testing.T) {
+	cases := []struct {
+		name     string
+		outcomes []Outcome
+		score    float64
+		isolate  bool //最后一次结果是否触发隔离
+	}{
+		{"new", nil, 1, false},
+		{"one failure", []Outcome{FAILED}, 0.8, false},
+		{"two failures", []Outcome{FAILED, FAILED}, 0.64, false},
+		{"recover", []Outcome{FAILED, GOOD}, 0.84, false},
+		{"max fails", []Outcome{FAILED, FAILED, FAILED}, 0.512, true},
+		{"fails reset by success", []Outcome{FAILED, FAILED, GOOD, FAILED}, 0.5696, false},
+		{"banned", []Outcome{BANNED}, 0.8, true},
+	}
+	for _, c := range cases {
+		h := newHealth()
+		var isolate bool
+		for _, o := range c.outcomes {
+			isolate = h.report(o)
+		}
+		if math.Abs(h.score-c.score) > 1e-9 || isolate != c.isolate {
+			t.Errorf("%s: score %v, isolate %v; want %v, %v", c.name, h.score, isolate, c.score, c.isolate)
+		}
+	}
+}
+
+func TestQuarantineBackoff(t *testing.T) {
+	now := time.Now()
+	h := newHealth()
+	want := []time.Duration{MIN_BACKOFF, 2 * MIN_BACKOFF, 4 * MIN_BACKOFF}
+	for d := 8 * MIN_BACKOFF; d < MAX_BACKOFF; d *= 2 {
+		want = append(want, d)
+	}
+	want = append(want, MAX_BACKOFF, MAX_BACKOFF)
+	for i, w := range want {
+		h.fails = MAX_FAILS
+		if got := h.quarantine(now); got != w {
+			t.Fatalf("quarantine #%d = %v, want %v", i+1, got, w)
+		}
+		if h.fails != 0 || h.usable(now.Add(w-time.Second)) || !h.usable(now.Add(w)) {
+			t.Errorf("quarantine #%d: fails %d, usable until %v", i+1, h.fails, h.until.Sub(now))
+		}
+	}
+
+	//连续成功RESET_SUCCESSES次后重新从MIN_BACKOFF开始
+	for i := 0; i < RESET_SUCCESSES-1; i++ {
+		h.report(GOOD)
+	}
+	if got := h.quarantine(now); got != MAX_BACKOFF {
+		t.Errorf("backoff reset after %d successes", RESET_SUCCESSES-1)
+	}
+	for i := 0; i < RESET_SUCCESSES; i++ {
+		h.report(GOOD)
+	}
+	if got := h.quarantine(now); got != MIN_BACKOFF {
+		t.Errorf("backoff after %d successes = %v, want %v", RESET_SUCCESSES, got, MIN_BACKOFF)
+	}
+}
+
+func TestPick(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name       string
+		cur        int
+		score      []float64
+		quarantine []bool
+		want       int //-1表示没有可用代理
+	}{
+		{"keep current", 0, []float64{0.6, 0.9}, []bool{false, false}, 0},
+		{"low score", 0, []float64{0.4, 0.6, 0.9}, []bool{false, false, false}, 2},
+		{"quarantined", 1, []float64{0.7, 1, 0.8}, []bool{false, true, false}, 2},
+		{"best even below threshold", 0, []float64{0.1, 0.3}, []bool{false, false}, 1},
+		{"tie keeps faster", 2, []float64{0.9, 0.9, 0.2}, []bool{false, false, false}, 0},
+		{"index out of range", 5, []float64{0.7, 0.8}, []bool{false, false}, 1},
+		{"all quarantined", 0, []float64{1, 1}, []bool{true, true}, -1},
+	}
+	for _, c := range cases {
+		p := &ProxyForHost{curIndex: c.cur, health: make(map[string]*health)}
+		for i, s := range c.score {
+			proxy := string(rune('a' + i))
+			p.proxys = append(p.proxys, proxy)
+			p.timedelay = append(p.timedelay, time.Duration(i))
+			h := p.healthOf(proxy)
+			h.score = s
+			if c.quarantine[i] {
+				h.quarantine(now)
+			}
+		}
+		ok := p.pick(now)
+		switch {
+		case c.want < 0 && ok:
+			t.Errorf("%s: picked %d, want none", c.name, p.curIndex)
+		case c.want >= 0 && (!ok || p.curIndex != c.want):
+			t.Errorf("%s: picked %d (%v), want %d", c.name, p.curIndex, ok, c.want)
+		}
+	}
+}
+
+//隔离只针对报告的主机，隔离期间的迟到结果不再计入
+func TestReport(t *testing.T) {
+	p := &Proxy{usable: map[string]*ProxyForHost{
+		"example.com": {proxys: []string{"http://a:80", "http://b:80"}, timedelay: make([]time.Duration, 2), health: make(map[string]*health)},
+		"other.com":   {proxys: []string{"http://a:80"}, timedelay: make([]time.Duration, 1), health: make(map[string]*health)},
+	}}
+	const target = "http://www.example.com/page"
+	for i := 0; i < MAX_FAILS-1; i++ {
+		p.Report("http://a:80", target, FAILED)
+	}
+	if !p.Usable("http://a:80", target) {
+		t.Fatalf("proxy quarantined after %d failures", MAX_FAILS-1)
+	}
+	p.Report("http://a:80", target, FAILED)
+	if p.Usable("http://a:80", target) {
+		t.Fatalf("proxy still usable after %d failures", MAX_FAILS)
+	}
+	if !p.Usable("http://a:80", "http://other.com/") || !p.Usable("http://b:80", target) {
+		t.Error("quarantine should only affect the reported proxy and host")
+	}
+
+	h := p.usable["example.com"].health["http://a:80"]
+	score := h.score
+	p.Report("http://a:80", target, BANNED)
+	if h.score != score || h.backoff != MIN_BACKOFF {
+		t.Errorf("late result counted during quarantine: score %v, backoff %v", h.score, h.backoff)
+	}
+
+	p.Report("http://b:80", target, BANNED)
+	if p.Usable("http://b:80", target) {
+		t.Error("banned proxy should be quarantined at once")
+	}
+	if p.usable["example.com"].pick(time.Now()) {
+		t.Error("no proxy should be available while all are quarantined")
+	}
+}
@@ -9,10 +9,53 @@ type ProxyForHost struct {
 	curIndex  int
 	proxys    []string
 	timedelay []time.Duration
+	health    map[string]*health //各代理对该主机的健康状况，重新测试与排序时保留
+	testHost  string             //测试代理时访问的地址
 	isEcho    bool
 	sync.Mutex
 }
 
+func (self *ProxyForHost) healthOf(proxy string) *health {
+	h := self.health[proxy]
+	if h == nil {
+		h = newHealth()
+		self.health[proxy] = h
+	}
+	return h
+}
+
+/**
+  确保当前代理可用：当前代理被隔离或评分低于MIN_SCORE时，
+  换用未被隔离的代理中评分最高者，评分相同时取延迟较低者
+  没有可用代理时返回false
+*/
+func (self *ProxyForHost) pick(now time.Time) bool {
+	if self.curIndex < len(self.proxys) {
+		if h := self.healthOf(self.proxys[self.curIndex]); h.usable(now) && h.score >= MIN_SCORE {
+			return true
+		}
+	}
+	best := -1
+	var bestScore float64
+	for i, proxy := range self.proxys {
+		h := self.healthOf(proxy)
+		if !h.usable(now) {
+			continue
+		}
+		if best < 0 || h.score > bestScore {
+			best, bestScore = i, h.score
+		}
+	}
+	if best < 0 {
+		return false
+	}
+	if best != self.curIndex {
+		self.curIndex = best
+		self.isEcho = true
+	}
+	return true
+}
+
 func (self *ProxyForHost) Len() int {
 	return len(self.proxys)
 }
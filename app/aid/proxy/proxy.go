@@ -1,36 +1,38 @@
 package proxy
 
 import (
-	"io/ioutil"
+	"bufio"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"regexp"
 	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/henrylee2cn/pholcus/common/ping"
 	"github.com/henrylee2cn/pholcus/config"
 	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/l-dandelion/gospider/app/aid/metrics"
 	"github.com/l-dandelion/gospider/app/downloader/request"
 	"github.com/l-dandelion/gospider/app/downloader/surfer"
 )
 
 type Proxy struct {
-	ipRegexp    *regexp.Regexp
-	proxyRegexp *regexp.Regexp
-	allIps      map[string]string
-	all         map[string]bool
-	online      int64
-	usable      map[string]*ProxyForHost
-	ticker      *time.Ticker
-	tickMinute  int64
-	threadPool  chan bool
-	surf        surfer.Surfer
+	addrs      map[string]string //代理地址 -> 代理服务器的 host:port
+	all        map[string]bool
+	online     int64
+	usable     map[string]*ProxyForHost
+	ticker     *time.Ticker
+	tickMinute int64
+	threadPool chan bool
+	surf       surfer.Surfer
+	apiUrl     string     //代理服务商的提取接口，返回一行一个或以逗号分隔的代理地址，为空时不使用
+	updating   sync.Mutex //保证同一时间只有一次更新
 	sync.Mutex
 }
 
@@ -40,61 +42,144 @@ const (
 	TRY_TIMES    = 3
 	//IP测速的最大并发量
 	MAX_THREAD_NUM = 1000
+	//读取代理列表的环境变量，多个代理之间以空白或逗号分隔
+	PROXY_ENV = "GOSPIDER_PROXY"
 )
 
 func New() *Proxy {
 	p := &Proxy{
-		ipRegexp:    regexp.MustCompile(`[0-9]+\.[0-9]+\.[0-9]+\.[0-9]+`),
-		proxyRegexp: regexp.MustCompile(`http[s]?://[0-9]+\.[0-9]+\.[0-9]+\.[0-9]+`),
-		allIps:      map[string]string{},
-		all:         map[string]bool{},
-		usable:      make(map[string]*ProxyForHost),
-		threadPool:  make(chan bool, MAX_THREAD_NUM),
-		surf:        surfer.New(),
+		addrs:      map[string]string{},
+		all:        map[string]bool{},
+		usable:     make(map[string]*ProxyForHost),
+		threadPool: make(chan bool, MAX_THREAD_NUM),
+		surf:       surfer.New(),
 	}
 	go p.Update()
 	return p
 }
 
+/**
+  从配置文件、环境变量 GOSPIDER_PROXY 及代理服务商接口读取代理
+  支持 http、https、socks5 代理，可带账号密码，无法解析的地址将被忽略
+*/
 func (self *Proxy) Update() *Proxy {
-	f, err := os.Open(config.PROXY)
-	if err != nil {
-		return self
+	self.updating.Lock()
+	defer self.updating.Unlock()
+	if f, err := os.Open(config.PROXY); err == nil {
+		self.add(f, config.PROXY)
+		f.Close()
 	}
-	b, _ := ioutil.ReadAll(f)
-	f.Close()
-
-	proxys := self.proxyRegexp.FindAllString(string(b), -1)
-	for _, proxy := range proxys {
-		self.allIps[proxy] = self.ipRegexp.FindString(proxy)
-		self.all[proxy] = false
+	if env := os.Getenv(PROXY_ENV); env != "" {
+		self.add(strings.NewReader(env), PROXY_ENV)
+	}
+	self.Lock()
+	api := self.apiUrl
+	self.Unlock()
+	if api != "" {
+		if err := self.fetch(api); err != nil {
+			log.Printf(" *     Fail [读取代理接口]: %v\n", err)
+		}
 	}
-	log.Printf(" *     读取代理ip: %v条\n", len(self.all))
+	self.Lock()
+	total := len(self.addrs)
+	self.Unlock()
+	log.Printf(" *     读取代理ip: %v条\n", total)
 	self.findOnline()
 	return self
 }
 
+//设置代理服务商的提取接口并在后台重新读取代理，接口未变时不做处理
+func (self *Proxy) SetApi(api string) {
+	self.Lock()
+	if api == "" || api == self.apiUrl {
+		self.Unlock()
+		return
+	}
+	self.apiUrl = api
+	self.Unlock()
+	go self.Update()
+}
+
+//从代理服务商接口读取代理
+func (self *Proxy) fetch(api string) error {
+	client := &http.Client{Timeout: time.Second * time.Duration(CONN_TIMEOUT+DIAL_TIMEOUT)}
+	resp, err := client.Get(api)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	self.add(resp.Body, "api")
+	return nil
+}
+
+//逐行读取代理地址，# 之后为注释
+func (self *Proxy) add(r io.Reader, from string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(c rune) bool {
+			return c == ',' || c == ';' || c == ' ' || c == '\t' || c == '\r'
+		})
+		for _, field := range fields {
+			u, err := surfer.ParseProxy(field)
+			if err != nil {
+				log.Printf(" *     [%v]忽略无效的代理: %v\n", from, err)
+				continue
+			}
+			proxy := u.String()
+			self.Lock()
+			self.addrs[proxy] = u.Host
+			self.Unlock()
+		}
+	}
+}
+
 func (self *Proxy) findOnline() *Proxy {
 	log.Printf(" *     正在筛选在线的代理IP......")
-	self.online = 0
-	for proxy := range self.all {
+	self.Lock()
+	addrs := make(map[string]string, len(self.addrs))
+	for proxy, addr := range self.addrs {
+		addrs[proxy] = addr
+	}
+	self.Unlock()
+	//筛选期间仍使用原有结果，完成后一次性替换
+	var (
+		all    = make(map[string]bool, len(addrs))
+		online int64
+		lock   sync.Mutex
+	)
+	for proxy, addr := range addrs {
 		self.threadPool <- true
-		go func(proxy string) {
-			alive, _, _ := ping.Ping(self.allIps[proxy], CONN_TIMEOUT)
-			self.Lock()
-			self.all[proxy] = alive
-			self.Unlock()
+		go func(proxy, addr string) {
+			//主机名无法ping，以能否连接代理端口判断是否在线
+			c, err := net.DialTimeout("tcp", addr, time.Second*time.Duration(CONN_TIMEOUT))
+			alive := err == nil
 			if alive {
-				atomic.AddInt64(&self.online, 1)
+				c.Close()
+				atomic.AddInt64(&online, 1)
 			}
+			lock.Lock()
+			all[proxy] = alive
+			lock.Unlock()
 			<-self.threadPool
-		}(proxy)
+		}(proxy, addr)
 	}
 	for len(self.threadPool) > 0 {
 		time.Sleep(0.2e9)
 	}
-	self.online = atomic.LoadInt64(&self.online)
-	log.Printf(" *     在线代理IP筛选完成，共计: %v个\n", self.online)
+	lock.Lock()
+	self.Lock()
+	self.all = all
+	atomic.StoreInt64(&self.online, online)
+	self.Unlock()
+	lock.Unlock()
+	log.Printf(" *     在线代理IP筛选完成，共计: %v个\n", online)
 	return self
 }
 
@@ -108,7 +193,7 @@ func (self *Proxy) UpdateTicker(tickMinute int64) {
 }
 
 func (self *Proxy) GetOne(u string) (curProxy string) {
-	if self.online == 0 {
+	if atomic.LoadInt64(&self.online) == 0 {
 		return
 	}
 	u2, _ := url.Parse(u)
@@ -116,10 +201,7 @@ func (self *Proxy) GetOne(u string) (curProxy string) {
 		logs.Log.Informational(" *     [%v]设置代理ip失败，目标url不正确\n", u)
 		return
 	}
-	var key = u2.Host
-	if strings.Count(key, ".") > 1 {
-		key = key[strings.Index(key, ".")+1:]
-	}
+	var key = hostKey(u2.Host)
 
 	self.Lock()
 	defer self.Unlock()
@@ -127,40 +209,136 @@ func (self *Proxy) GetOne(u string) (curProxy string) {
 	var ok = true
 	var proxyForHost = self.usable[key]
 
-	select {
-	case <-self.ticker.C:
-		proxyForHost.curIndex++
-		if proxyForHost.curIndex >= proxyForHost.Len() {
-			_, ok = self.testAndSort(key, u2.Scheme+"://"+u2.Host)
+	if proxyForHost == nil {
+		self.usable[key] = &ProxyForHost{
+			proxys:    []string{},
+			timedelay: []time.Duration{},
+			health:    make(map[string]*health),
+			testHost:  u2.Scheme + "://" + u2.Host,
+			isEcho:    true,
 		}
-		proxyForHost.isEcho = true
-	default:
-		if proxyForHost == nil {
-			self.usable[key] = &ProxyForHost{
-				proxys:    []string{},
-				timedelay: []time.Duration{},
-				isEcho:    true,
+		proxyForHost, ok = self.testAndSort(key, u2.Scheme+"://"+u2.Host)
+	} else {
+		select {
+		case <-self.ticker.C:
+			proxyForHost.curIndex++
+			if proxyForHost.curIndex >= proxyForHost.Len() {
+				_, ok = self.testAndSort(key, u2.Scheme+"://"+u2.Host)
 			}
-			proxyForHost, ok = self.testAndSort(key, u2.Scheme+"://"+u2.Host)
-		} else if l := proxyForHost.Len(); l == 0 {
-			ok = false
-		} else if proxyForHost.curIndex >= l {
-			_, ok = self.testAndSort(key, u2.Scheme+"://"+u2.Host)
 			proxyForHost.isEcho = true
+		default:
+			if l := proxyForHost.Len(); l == 0 {
+				ok = false
+			} else if proxyForHost.curIndex >= l {
+				_, ok = self.testAndSort(key, u2.Scheme+"://"+u2.Host)
+				proxyForHost.isEcho = true
+			}
 		}
 	}
+	//当前代理被隔离或评分过低时换用其他代理
+	if ok {
+		ok = proxyForHost.pick(time.Now())
+	}
 	if !ok {
 		logs.Log.Informational(" *     [%v]设置代理IP失败,没有可用的代理IP\n", key)
+		metrics.IncProxySelection("")
 		return
 	}
 	curProxy = proxyForHost.proxys[proxyForHost.curIndex]
+	metrics.IncProxySelection(surfer.RedactProxy(curProxy))
 	if proxyForHost.isEcho {
-		logs.Log.Informational(" *     设置代理IP为 [%v](%v)\n", curProxy, proxyForHost.timedelay[proxyForHost.curIndex])
+		logs.Log.Informational(" *     设置代理IP为 [%v](%v)\n", surfer.RedactProxy(curProxy), proxyForHost.timedelay[proxyForHost.curIndex])
 		proxyForHost.isEcho = false
 	}
 	return
 }
 
+/**
+  反馈代理访问目标url的结果
+  被封禁或连续失败的代理将对该主机隔离，隔离期满后在后台重新测试，通过后恢复使用
+*/
+func (self *Proxy) Report(proxy string, u string, outcome Outcome) {
+	if proxy == "" {
+		return
+	}
+	u2, err := url.Parse(u)
+	if err != nil || u2.Host == "" {
+		return
+	}
+	var key = hostKey(u2.Host)
+
+	self.Lock()
+	defer self.Unlock()
+
+	proxyForHost := self.usable[key]
+	if proxyForHost == nil {
+		return
+	}
+	now := time.Now()
+	h := proxyForHost.healthOf(proxy)
+	//隔离前已发出的请求，其结果不再计入
+	if !h.usable(now) || !h.report(outcome) {
+		return
+	}
+	backoff := h.quarantine(now)
+	if proxyForHost.curIndex < proxyForHost.Len() && proxy == proxyForHost.proxys[proxyForHost.curIndex] {
+		proxyForHost.isEcho = true
+	}
+	metrics.IncProxyQuarantine(surfer.RedactProxy(proxy), outcome.String())
+	logs.Log.Warning(" *     [%v]代理IP [%v] 已隔离 %v（%v）\n", key, surfer.RedactProxy(proxy), backoff, outcome)
+	time.AfterFunc(backoff, func() { self.retest(key, proxy) })
+}
+
+//隔离期满后重新测试代理，仍不可用时加倍隔离时长
+func (self *Proxy) retest(key string, proxy string) {
+	self.Lock()
+	proxyForHost := self.usable[key]
+	h := proxyForHost.healthOf(proxy)
+	h.testing = true
+	testHost := proxyForHost.testHost
+	self.Unlock()
+
+	alive, _ := self.findUsable(proxy, testHost)
+
+	self.Lock()
+	defer self.Unlock()
+	h.testing = false
+	if alive {
+		if h.score < MIN_SCORE {
+			h.score = MIN_SCORE
+		}
+		logs.Log.Informational(" *     [%v]代理IP [%v] 重新测试通过，恢复使用\n", key, surfer.RedactProxy(proxy))
+		return
+	}
+	backoff := h.quarantine(time.Now())
+	logs.Log.Warning(" *     [%v]代理IP [%v] 重新测试失败，继续隔离 %v\n", key, surfer.RedactProxy(proxy), backoff)
+	time.AfterFunc(backoff, func() { self.retest(key, proxy) })
+}
+
+//代理对目标url是否可用，未被隔离即视为可用
+func (self *Proxy) Usable(proxy string, u string) bool {
+	u2, err := url.Parse(u)
+	if err != nil || u2.Host == "" {
+		return true
+	}
+	self.Lock()
+	defer self.Unlock()
+	proxyForHost := self.usable[hostKey(u2.Host)]
+	if proxyForHost == nil {
+		return true
+	}
+	h := proxyForHost.health[proxy]
+	return h == nil || h.usable(time.Now())
+}
+
+//同一主域名下的主机共用代理列表
+func hostKey(host string) string {
+	if strings.Count(host, ".") > 1 {
+		return host[strings.Index(host, ".")+1:]
+	}
+	return host
+}
+
 func (self *Proxy) testAndSort(key string, testHost string) (*ProxyForHost, bool) {
 	logs.Log.Informational(" *     [%v]正在测试与排序代理ip......", key)
 	proxyForHost := self.usable[key]
@@ -206,10 +384,16 @@ func (self *Proxy) findUsable(proxy string, testHost string) (alive bool, timede
 		TryTimes:    TRY_TIMES,
 	}
 	req.SetProxy(proxy)
-	_, err := self.surf.Download(req)
-	return err == nil, time.Since(t0)
+	resp, err := self.surf.Download(req)
+	var statusCode int
+	if err == nil {
+		statusCode = resp.StatusCode
+		resp.Body.Close()
+	}
+	//已被目标站点封禁的代理同样视为不可用
+	return Judge(statusCode, err, false) == GOOD, time.Since(t0)
 }
 
 func (self *Proxy) Count() int64 {
-	return self.online
+	return atomic.LoadInt64(&self.online)
 }
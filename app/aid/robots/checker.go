@@ -0,0 +1,168 @@
+package robots
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/l-dandelion/gospider/app/downloader/request"
+	"github.com/l-dandelion/gospider/app/downloader/surfer"
+)
+
+const (
+	DEFAULT_USER_AGENT = "gospider"
+	CACHE_TTL          = 24 * time.Hour   //robots.txt缓存时长
+	ERROR_TTL          = 10 * time.Minute //获取失败时的缓存时长
+	CONN_TIMEOUT       = 10 * time.Second
+	DIAL_TIMEOUT       = 10 * time.Second
+	TRY_TIMES          = 2
+)
+
+type (
+	Checker struct {
+		entries map[string]*entry //[scheme://host]
+		blocked uint64
+		sync.Mutex
+	}
+
+	entry struct {
+		robots  *Robots //为nil时获取失败
+		expires time.Time
+		ready   chan bool
+	}
+)
+
+//robots.txt暂时无法获取，应在其缓存过期后重试
+var ErrUnavailable = errors.New("robots.txt暂时无法获取")
+
+var DefaultChecker = NewChecker()
+
+func NewChecker() *Checker {
+	return &Checker{
+		entries: make(map[string]*entry),
+	}
+}
+
+/**
+  检查userAgent是否允许访问req
+  返回是否允许，以及该主机对userAgent声明的Crawl-delay，被禁止时计数加一；
+  robots.txt经与req相同的下载器、代理与会话获取，暂时无法获取时返回ErrUnavailable，delay为距下次重新获取的时长
+*/
+func (self *Checker) Check(req *request.Request, userAgent string) (allowed bool, delay time.Duration, err error) {
+	u, err := url.Parse(req.GetUrl())
+	if err != nil || u.Host == "" {
+		return true, 0, nil
+	}
+	if userAgent == "" {
+		userAgent = DEFAULT_USER_AGENT
+	}
+	robots, expires := self.get(u.Scheme+"://"+u.Host, userAgent, req)
+	if robots == nil {
+		return false, time.Until(expires), ErrUnavailable
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	allowed = robots.Test(path, userAgent)
+	if !allowed {
+		atomic.AddUint64(&self.blocked, 1)
+	}
+	return allowed, robots.CrawlDelay(userAgent), nil
+}
+
+//被robots.txt禁止的请求数
+func (self *Checker) Blocked() uint64 {
+	return atomic.LoadUint64(&self.blocked)
+}
+
+func (self *Checker) ResetBlocked() {
+	atomic.StoreUint64(&self.blocked, 0)
+}
+
+//获取该站点的robots.txt及其缓存的过期时间，同一站点同时只获取一次
+func (self *Checker) get(site, userAgent string, via *request.Request) (*Robots, time.Time) {
+	self.Lock()
+	e, ok := self.entries[site]
+	if ok && (e.expires.IsZero() || time.Now().Before(e.expires)) {
+		self.Unlock()
+		<-e.ready
+		self.Lock()
+		defer self.Unlock()
+		return e.robots, e.expires
+	}
+	e = &entry{ready: make(chan bool)}
+	self.entries[site] = e
+	self.Unlock()
+
+	robots, ttl := self.fetch(site, userAgent, via)
+	self.Lock()
+	e.robots = robots
+	e.expires = time.Now().Add(ttl)
+	self.Unlock()
+	close(e.ready)
+	return robots, e.expires
+}
+
+/**
+  以userAgent获取并解析robots.txt，沿用via的代理、会话与cookie设置
+  2xx时按内容解析；4xx视为全部允许；5xx或网络错误返回nil，并缩短缓存时长，期满后重新获取
+*/
+func (self *Checker) fetch(site, userAgent string, via *request.Request) (*Robots, time.Duration) {
+	req := &request.Request{
+		Url:          site + "/robots.txt",
+		Method:       "GET",
+		Header:       http.Header{"User-Agent": {userAgent}},
+		EnableCookie: via.GetEnableCookie(),
+		DialTimeout:  DIAL_TIMEOUT,
+		ConnTimeout:  CONN_TIMEOUT,
+		TryTimes:     TRY_TIMES,
+		RetryPause:   request.DefaultRetryPause,
+		Session:      via.GetSession(),
+		CookieScope:  via.GetCookieScope(),
+	}
+	req.SetProxy(via.GetProxy())
+	resp, err := surfer.Download(req)
+	if err != nil {
+		logs.Log.Warning(" *     [robots.txt][%v]: %v，暂缓访问该站点\n", site, err)
+		return nil, ERROR_TTL
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		logs.Log.Warning(" *     [robots.txt][%v]: 响应状态 %v，暂缓访问该站点\n", site, resp.Status)
+		return nil, ERROR_TTL
+	case resp.StatusCode >= 400:
+		return allowAll, CACHE_TTL
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		logs.Log.Warning(" *     [robots.txt][%v]: %v，暂缓访问该站点\n", site, err)
+		return nil, ERROR_TTL
+	}
+	logs.Log.Informational(" *     [robots.txt][%v]: 已获取\n", site)
+	return Parse(b), CACHE_TTL
+}
+
+func Check(req *request.Request, userAgent string) (bool, time.Duration, error) {
+	return DefaultChecker.Check(req, userAgent)
+}
+
+func Blocked() uint64 {
+	return DefaultChecker.Blocked()
+}
+
+func ResetBlocked() {
+	DefaultChecker.ResetBlocked()
+}
@@ -0,0 +1,164 @@
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	//解析后的robots.txt
+	Robots struct {
+		groups []*group
+	}
+
+	group struct {
+		agents     []string
+		rules      []rule
+		crawlDelay time.Duration
+	}
+
+	rule struct {
+		allow   bool
+		pattern string
+	}
+)
+
+var allowAll = &Robots{}
+
+/**
+  解析robots.txt内容
+  支持User-agent、Allow、Disallow、Crawl-delay，路径规则支持 * 通配与 $ 结尾锚定
+*/
+func Parse(body []byte) *Robots {
+	var (
+		robots  = &Robots{}
+		cur     *group
+		inRules bool
+		scanner = bufio.NewScanner(bytes.NewReader(body))
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			//连续的User-agent行属于同一组
+			if cur == nil || inRules {
+				cur = &group{}
+				robots.groups = append(robots.groups, cur)
+				inRules = false
+			}
+			cur.agents = append(cur.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if cur == nil {
+				continue
+			}
+			inRules = true
+			if value == "" {
+				//空的Disallow表示全部允许
+				continue
+			}
+			cur.rules = append(cur.rules, rule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			if cur == nil {
+				continue
+			}
+			inRules = true
+			if sec, err := strconv.ParseFloat(value, 64); err == nil && sec > 0 {
+				cur.crawlDelay = time.Duration(sec * float64(time.Second))
+			}
+		}
+	}
+	return robots
+}
+
+//查找与userAgent匹配的规则组，找不到时使用 * 组
+func (self *Robots) find(userAgent string) *group {
+	userAgent = strings.ToLower(userAgent)
+	var (
+		matched  *group
+		matchLen int
+		wildcard *group
+	)
+	for _, g := range self.groups {
+		for _, agent := range g.agents {
+			if agent == "*" {
+				if wildcard == nil {
+					wildcard = g
+				}
+				continue
+			}
+			if strings.Contains(userAgent, agent) && len(agent) > matchLen {
+				matched, matchLen = g, len(agent)
+			}
+		}
+	}
+	if matched != nil {
+		return matched
+	}
+	return wildcard
+}
+
+//判断userAgent是否允许访问path（含查询参数），最长匹配的规则生效，长度相同时Allow优先
+func (self *Robots) Test(path, userAgent string) bool {
+	g := self.find(userAgent)
+	if g == nil {
+		return true
+	}
+	var (
+		allow   = true
+		bestLen = -1
+	)
+	for _, r := range g.rules {
+		if !match(r.pattern, path) {
+			continue
+		}
+		if l := len(r.pattern); l > bestLen || (l == bestLen && r.allow) {
+			allow, bestLen = r.allow, l
+		}
+	}
+	return allow
+}
+
+//userAgent对应的Crawl-delay，未设置时为0
+func (self *Robots) CrawlDelay(userAgent string) time.Duration {
+	g := self.find(userAgent)
+	if g == nil {
+		return 0
+	}
+	return g.crawlDelay
+}
+
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if i == len(parts)-2 && anchored {
+			return strings.HasSuffix(rest, part)
+		}
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	return !anchored || rest == ""
+}
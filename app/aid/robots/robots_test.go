@@ -0,0 +1,158 @@
+package robots
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/l-dandelion/gospider/app/downloader/request"
+)
+
+const testRobots = `
+# 注释
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+Crawl-delay: 1.5
+
+User-agent: GoodBot
+User-agent: OtherBot
+Allow: /
+Disallow: /admin
+
+User-agent: BadBot
+Disallow: /
+`
+
+func TestRobotsTest(t *testing.T) {
+	robots := Parse([]byte(testRobots))
+	cases := []struct {
+		agent string
+		path  string
+		want  bool
+	}{
+		{"gospider", "/", true},
+		{"gospider", "/private/", false},
+		{"gospider", "/private/page", false},
+		{"gospider", "/private/public", true},
+		{"gospider", "/private/public/more", true},
+		{"gospider", "/doc.pdf", false},
+		{"gospider", "/doc.pdf?x=1", true},
+		{"gospider", "/search?q=1", false},
+		{"gospider", "/search", true},
+		{"Mozilla/5.0 (compatible; GoodBot/1.0)", "/private/page", true},
+		{"goodbot", "/admin/users", false},
+		{"OtherBot", "/admin", false},
+		{"OtherBot", "/", true},
+		{"BadBot", "/", false},
+		{"BadBot", "/anything", false},
+	}
+	for _, c := range cases {
+		if got := robots.Test(c.path, c.agent); got != c.want {
+			t.Errorf("Test(%q, %q) = %v, want %v", c.path, c.agent, got, c.want)
+		}
+	}
+}
+
+func TestRobotsPrecedence(t *testing.T) {
+	cases := []struct {
+		body string
+		path string
+		want bool
+	}{
+		//最长匹配的规则生效
+		{"User-agent: *\nAllow: /a\nDisallow: /a/b", "/a/b/c", false},
+		{"User-agent: *\nDisallow: /a\nAllow: /a/b", "/a/b/c", true},
+		//长度相同时Allow优先
+		{"User-agent: *\nDisallow: /page\nAllow: /page", "/page", true},
+		{"User-agent: *\nAllow: /page\nDisallow: /page", "/page", true},
+		//空的Disallow表示全部允许
+		{"User-agent: *\nDisallow:", "/any", true},
+		//通配与锚定
+		{"User-agent: *\nDisallow: /*/edit$", "/post/1/edit", false},
+		{"User-agent: *\nDisallow: /*/edit$", "/post/1/edit/more", true},
+		{"User-agent: *\nDisallow: /a*b*c", "/a-x-b-y-c-z", false},
+		{"User-agent: *\nDisallow: /a*b*c", "/a-x-c-y-b", true},
+		{"User-agent: *\nDisallow: /a*b*c", "/a-x-c", true},
+		//组外的规则被忽略
+		{"Disallow: /\nUser-agent: *\nAllow: /", "/x", true},
+		//没有匹配的组时全部允许
+		{"User-agent: other\nDisallow: /", "/x", true},
+		{"", "/x", true},
+	}
+	for _, c := range cases {
+		if got := Parse([]byte(c.body)).Test(c.path, "gospider"); got != c.want {
+			t.Errorf("%q: Test(%q) = %v, want %v", c.body, c.path, got, c.want)
+		}
+	}
+}
+
+func TestCrawlDelay(t *testing.T) {
+	robots := Parse([]byte(testRobots))
+	if d := robots.CrawlDelay("gospider"); d != 1500*time.Millisecond {
+		t.Errorf("CrawlDelay(gospider) = %v, want 1.5s", d)
+	}
+	if d := robots.CrawlDelay("GoodBot"); d != 0 {
+		t.Errorf("CrawlDelay(GoodBot) = %v, want 0", d)
+	}
+}
+
+//robots.txt经请求的代理获取：目标主机无法直接访问，只能通过代理取得
+func TestCheckerUsesProxy(t *testing.T) {
+	var fetched int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "robots.test.invalid" || r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&fetched, 1)
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\nCrawl-delay: 2\n")
+	}))
+	defer proxy.Close()
+
+	checker := NewChecker()
+	cases := []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://robots.test.invalid/index", true},
+		{"http://robots.test.invalid/private/1", false},
+	}
+	for _, c := range cases {
+		req := &request.Request{Url: c.url}
+		req.SetProxy(proxy.URL)
+		allowed, delay, err := checker.Check(req, "")
+		if err != nil {
+			t.Fatalf("Check(%s): %v", c.url, err)
+		}
+		if allowed != c.allowed || delay != 2*time.Second {
+			t.Errorf("Check(%s) = %v, %v; want %v, 2s", c.url, allowed, delay, c.allowed)
+		}
+	}
+	if n := atomic.LoadInt32(&fetched); n != 1 {
+		t.Errorf("robots.txt fetched %d times, want 1 (cached)", n)
+	}
+	if checker.Blocked() != 1 {
+		t.Errorf("Blocked() = %d, want 1", checker.Blocked())
+	}
+}
+
+func TestCheckerUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	allowed, delay, err := NewChecker().Check(&request.Request{Url: srv.URL + "/page"}, "")
+	if err != ErrUnavailable || allowed {
+		t.Fatalf("Check = %v, %v; want false, ErrUnavailable", allowed, err)
+	}
+	if delay <= 0 || delay > ERROR_TTL {
+		t.Errorf("retry delay = %v, want within (0, %v]", delay, ERROR_TTL)
+	}
+}
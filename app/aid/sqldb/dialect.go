@@ -0,0 +1,165 @@
+package sqldb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/l-dandelion/gospider/app/pipeline/collector/data"
+)
+
+//各数据库在SQL语法上的差异
+type Dialect interface {
+	Quote(ident string) string          //引用表名、列名
+	Placeholder(n int) string           //第n个参数的占位符，n从1开始
+	MaxArgs() int                       //单条语句的最大参数数
+	ColumnType(t data.FieldType) string //字段类型对应的列类型
+	KeyText() string                    //可建立索引的短文本列类型
+	AutoId() string                     //自增主键列的定义
+	TableOptions() string               //建表语句的表选项
+	Upsert(key []string, update []string) string
+	ColumnsQuery(table string) (string, []interface{}) //查询已有列名的语句，结果第一列为列名
+	IndexesQuery(table string) (string, []interface{}) //查询已有索引名的语句，结果第一列为索引名
+}
+
+type (
+	mysqlDialect    struct{}
+	postgresDialect struct{}
+	sqliteDialect   struct{}
+)
+
+func quote(ident string, q string) string {
+	return q + strings.Replace(ident, q, q+q, -1) + q
+}
+
+/************************ MySQL ***************************/
+
+func (mysqlDialect) Quote(ident string) string { return quote(ident, "`") }
+func (mysqlDialect) Placeholder(int) string    { return "?" }
+func (mysqlDialect) MaxArgs() int              { return 60000 }
+func (mysqlDialect) KeyText() string           { return "VARCHAR(255)" }
+func (mysqlDialect) TableOptions() string      { return " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4" }
+
+func (mysqlDialect) AutoId() string {
+	return "`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY"
+}
+
+func (mysqlDialect) ColumnType(t data.FieldType) string {
+	switch t {
+	case data.TYPE_INT:
+		return "BIGINT"
+	case data.TYPE_FLOAT:
+		return "DOUBLE"
+	case data.TYPE_BOOL:
+		return "TINYINT(1)"
+	case data.TYPE_TIME:
+		return "DATETIME"
+	}
+	return "MEDIUMTEXT"
+}
+
+func (self mysqlDialect) Upsert(key []string, update []string) string {
+	var sets []string
+	for _, c := range update {
+		c = self.Quote(c)
+		sets = append(sets, c+"=VALUES("+c+")")
+	}
+	if len(sets) == 0 {
+		k := self.Quote(key[0])
+		sets = append(sets, k+"="+k)
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
+}
+
+func (mysqlDialect) ColumnsQuery(table string) (string, []interface{}) {
+	return "SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", []interface{}{table}
+}
+
+func (mysqlDialect) IndexesQuery(table string) (string, []interface{}) {
+	return "SELECT DISTINCT INDEX_NAME FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", []interface{}{table}
+}
+
+/************************ PostgreSQL ***************************/
+
+func (postgresDialect) Quote(ident string) string { return quote(ident, `"`) }
+func (postgresDialect) Placeholder(n int) string  { return "$" + strconv.Itoa(n) }
+func (postgresDialect) MaxArgs() int              { return 60000 }
+func (postgresDialect) KeyText() string           { return "TEXT" }
+func (postgresDialect) AutoId() string            { return `"id" BIGSERIAL PRIMARY KEY` }
+func (postgresDialect) TableOptions() string      { return "" }
+
+func (postgresDialect) ColumnType(t data.FieldType) string {
+	switch t {
+	case data.TYPE_INT:
+		return "BIGINT"
+	case data.TYPE_FLOAT:
+		return "DOUBLE PRECISION"
+	case data.TYPE_BOOL:
+		return "BOOLEAN"
+	case data.TYPE_TIME:
+		return "TIMESTAMP"
+	}
+	return "TEXT"
+}
+
+func (self postgresDialect) Upsert(key []string, update []string) string {
+	return onConflict(self, key, update)
+}
+
+func (postgresDialect) ColumnsQuery(table string) (string, []interface{}) {
+	return "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1", []interface{}{table}
+}
+
+func (postgresDialect) IndexesQuery(table string) (string, []interface{}) {
+	return "SELECT indexname FROM pg_indexes WHERE schemaname = current_schema() AND tablename = $1", []interface{}{table}
+}
+
+/************************ SQLite ***************************/
+
+func (sqliteDialect) Quote(ident string) string { return quote(ident, `"`) }
+func (sqliteDialect) Placeholder(int) string    { return "?" }
+func (sqliteDialect) MaxArgs() int              { return 999 }
+func (sqliteDialect) KeyText() string           { return "TEXT" }
+func (sqliteDialect) AutoId() string            { return `"id" INTEGER PRIMARY KEY AUTOINCREMENT` }
+func (sqliteDialect) TableOptions() string      { return "" }
+
+func (sqliteDialect) ColumnType(t data.FieldType) string {
+	switch t {
+	case data.TYPE_INT, data.TYPE_BOOL:
+		return "INTEGER"
+	case data.TYPE_FLOAT:
+		return "REAL"
+	case data.TYPE_TIME:
+		return "DATETIME"
+	}
+	return "TEXT"
+}
+
+func (self sqliteDialect) Upsert(key []string, update []string) string {
+	return onConflict(self, key, update)
+}
+
+func (self sqliteDialect) ColumnsQuery(table string) (string, []interface{}) {
+	return fmt.Sprintf("SELECT name FROM pragma_table_info(%s)", quote(table, "'")), nil
+}
+
+func (sqliteDialect) IndexesQuery(table string) (string, []interface{}) {
+	return "SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ?", []interface{}{table}
+}
+
+//PostgreSQL与SQLite共用的 ON CONFLICT 语法
+func onConflict(d Dialect, key []string, update []string) string {
+	keys := make([]string, len(key))
+	for i, k := range key {
+		keys[i] = d.Quote(k)
+	}
+	if len(update) == 0 {
+		return " ON CONFLICT (" + strings.Join(keys, ",") + ") DO NOTHING"
+	}
+	sets := make([]string, len(update))
+	for i, c := range update {
+		c = d.Quote(c)
+		sets[i] = c + "=EXCLUDED." + c
+	}
+	return " ON CONFLICT (" + strings.Join(keys, ",") + ") DO UPDATE SET " + strings.Join(sets, ",")
+}
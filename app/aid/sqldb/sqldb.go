@@ -0,0 +1,119 @@
+package sqldb
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/henrylee2cn/pholcus/common/mysql"
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+/**
+  基于database/sql的通用数据库访问层
+  供结果输出与历史记录共用，按名称区分：mysql、postgres、sqlite
+*/
+type DB struct {
+	*sql.DB
+	Dialect
+	tables map[string]*tableInfo //已确认存在的表结构
+	lock   sync.Mutex
+}
+
+type provider struct {
+	dialect Dialect
+	open    func() (*sql.DB, error)
+	db      *DB
+}
+
+var (
+	PostgresDSN = "postgres://postgres@127.0.0.1:5432/" + config.DB_NAME + "?sslmode=disable"
+	SqlitePath  = filepath.Join(config.WORK_ROOT, config.DB_NAME+".sqlite")
+
+	providers = map[string]*provider{
+		"mysql": {
+			dialect: mysqlDialect{},
+			open:    mysql.DB,
+		},
+		"postgres": {
+			dialect: postgresDialect{},
+			open: func() (*sql.DB, error) {
+				return sql.Open("postgres", PostgresDSN)
+			},
+		},
+		"sqlite": {
+			dialect: sqliteDialect{},
+			open: func() (*sql.DB, error) {
+				if err := os.MkdirAll(filepath.Dir(SqlitePath), 0777); err != nil {
+					return nil, err
+				}
+				db, err := sql.Open("sqlite3", SqlitePath+"?_busy_timeout=5000")
+				if err == nil {
+					//SQLite不支持并发写入
+					db.SetMaxOpenConns(1)
+				}
+				return db, err
+			},
+		},
+	}
+	providersLock sync.Mutex
+)
+
+//按名称获取数据库连接，首次获取时建立连接
+func Get(name string) (*DB, error) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("不支持的数据库: %s", name)
+	}
+	if p.db != nil {
+		return p.db, nil
+	}
+	db, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		if name != "mysql" {
+			db.Close()
+		}
+		return nil, err
+	}
+	p.db = &DB{
+		DB:      db,
+		Dialect: p.dialect,
+		tables:  make(map[string]*tableInfo),
+	}
+	return p.db, nil
+}
+
+//检查连接，失效时丢弃，下次获取时重新建立
+//MySQL连接池由pholcus管理，其Refresh后需重新获取
+func Refresh(name string) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	p, ok := providers[name]
+	if !ok || p.db == nil {
+		return
+	}
+	if name == "mysql" {
+		p.db = nil
+		return
+	}
+	if err := p.db.Ping(); err != nil {
+		p.db.Close()
+		p.db = nil
+	}
+}
+
+//是否为本包支持的数据库名称
+func Supported(name string) bool {
+	_, ok := providers[name]
+	return ok
+}
@@ -0,0 +1,337 @@
+package sqldb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/l-dandelion/gospider/app/pipeline/collector/data"
+)
+
+/************************ 记录执行语句的驱动 ***************************/
+
+type recorder struct {
+	columns []string //已有列
+	indexes []string //已有索引
+	stmts   []string //执行的语句
+	args    [][]driver.Value
+	sync.Mutex
+}
+
+type (
+	recordDriver struct{}
+	recordConn   struct{ r *recorder }
+	recordStmt   struct {
+		r     *recorder
+		query string
+	}
+	recordRows struct {
+		names []string
+		i     int
+	}
+)
+
+var (
+	recorders     = make(map[string]*recorder)
+	recordersLock sync.Mutex
+)
+
+func init() {
+	sql.Register("sqldb_test", recordDriver{})
+}
+
+func (recordDriver) Open(name string) (driver.Conn, error) {
+	recordersLock.Lock()
+	defer recordersLock.Unlock()
+	return recordConn{recorders[name]}, nil
+}
+
+func (c recordConn) Prepare(query string) (driver.Stmt, error) {
+	return recordStmt{c.r, query}, nil
+}
+func (recordConn) Close() error              { return nil }
+func (recordConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (recordStmt) Close() error  { return nil }
+func (recordStmt) NumInput() int { return -1 }
+
+func (s recordStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.r.Lock()
+	defer s.r.Unlock()
+	s.r.stmts = append(s.r.stmts, s.query)
+	s.r.args = append(s.r.args, args)
+	return driver.RowsAffected(1), nil
+}
+
+//查询已有索引的语句返回索引名，其余返回列名
+func (s recordStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.r.Lock()
+	defer s.r.Unlock()
+	if strings.Contains(strings.ToLower(s.query), "index") {
+		return &recordRows{names: s.r.indexes}, nil
+	}
+	return &recordRows{names: s.r.columns}, nil
+}
+
+func (*recordRows) Columns() []string { return []string{"name"} }
+func (*recordRows) Close() error      { return nil }
+
+func (self *recordRows) Next(dest []driver.Value) error {
+	if self.i >= len(self.names) {
+		return io.EOF
+	}
+	dest[0] = self.names[self.i]
+	self.i++
+	return nil
+}
+
+func newTestDB(t *testing.T, d Dialect, columns, indexes []string) (*DB, *recorder) {
+	r := &recorder{columns: columns, indexes: indexes}
+	recordersLock.Lock()
+	recorders[t.Name()] = r
+	recordersLock.Unlock()
+	db, err := sql.Open("sqldb_test", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &DB{DB: db, Dialect: d, tables: make(map[string]*tableInfo)}, r
+}
+
+/************************ 测试 ***************************/
+
+var dialects = map[string]Dialect{
+	"mysql":    mysqlDialect{},
+	"postgres": postgresDialect{},
+	"sqlite":   sqliteDialect{},
+}
+
+var testTable = &Table{
+	Name: "items",
+	Columns: []Column{
+		{"title", "TEXT"},
+		{"price", "REAL"},
+	},
+	UniqueKeys: [][]string{{"title"}},
+	Indexes:    [][]string{{"price"}},
+}
+
+func TestEnsure(t *testing.T) {
+	cases := []struct {
+		name    string
+		dialect string
+		columns []string
+		indexes []string
+		want    []string
+	}{
+		{
+			name:    "create",
+			dialect: "mysql",
+			want: []string{
+				"CREATE TABLE IF NOT EXISTS `items` (`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY, `title` TEXT, `price` REAL) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+				"CREATE INDEX `idx_items__price` ON `items` (`price`)",
+				"CREATE UNIQUE INDEX `uk_items__title` ON `items` (`title`)",
+			},
+		},
+		{
+			name:    "create",
+			dialect: "postgres",
+			want: []string{
+				`CREATE TABLE IF NOT EXISTS "items" ("id" BIGSERIAL PRIMARY KEY, "title" TEXT, "price" REAL)`,
+				`CREATE INDEX "idx_items__price" ON "items" ("price")`,
+				`CREATE UNIQUE INDEX "uk_items__title" ON "items" ("title")`,
+			},
+		},
+		{
+			name:    "create",
+			dialect: "sqlite",
+			want: []string{
+				`CREATE TABLE IF NOT EXISTS "items" ("id" INTEGER PRIMARY KEY AUTOINCREMENT, "title" TEXT, "price" REAL)`,
+				`CREATE INDEX "idx_items__price" ON "items" ("price")`,
+				`CREATE UNIQUE INDEX "uk_items__title" ON "items" ("title")`,
+			},
+		},
+		{
+			name:    "add column",
+			dialect: "mysql",
+			columns: []string{"id", "TITLE"},
+			indexes: []string{"uk_items__title", "idx_items__price"},
+			want:    []string{"ALTER TABLE `items` ADD COLUMN `price` REAL"},
+		},
+		{
+			name:    "add column and index",
+			dialect: "postgres",
+			columns: []string{"id", "title"},
+			indexes: []string{"uk_items__title"},
+			want: []string{
+				`ALTER TABLE "items" ADD COLUMN "price" REAL`,
+				`CREATE INDEX "idx_items__price" ON "items" ("price")`,
+			},
+		},
+		{
+			name:    "up to date",
+			dialect: "sqlite",
+			columns: []string{"id", "title", "price"},
+			indexes: []string{"uk_items__title", "idx_items__price"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.dialect+"/"+c.name, func(t *testing.T) {
+			db, r := newTestDB(t, dialects[c.dialect], c.columns, c.indexes)
+			if err := db.Ensure(testTable); err != nil {
+				t.Fatal(err)
+			}
+			//建表之后的语句顺序不定
+			got := append([]string(nil), r.stmts...)
+			if len(got) > 1 {
+				sort.Strings(got[1:])
+			}
+			if len(got) != len(c.want) || (len(got) > 0 && !reflect.DeepEqual(got, c.want)) {
+				t.Errorf("executed %q\nwant %q", got, c.want)
+			}
+
+			//表结构已缓存，再次确认时不执行任何语句
+			n := len(r.stmts)
+			if err := db.Ensure(testTable); err != nil {
+				t.Fatal(err)
+			}
+			if len(r.stmts) != n {
+				t.Errorf("second Ensure executed %q", r.stmts[n:])
+			}
+		})
+	}
+}
+
+func TestEnsurePrimaryKey(t *testing.T) {
+	db, r := newTestDB(t, postgresDialect{}, nil, nil)
+	err := db.Ensure(&Table{
+		Name:       "history",
+		Columns:    []Column{{"spider", "TEXT"}, {"key", "TEXT"}},
+		PrimaryKey: []string{"spider", "key"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `CREATE TABLE IF NOT EXISTS "history" ("spider" TEXT, "key" TEXT, PRIMARY KEY ("spider","key"))`
+	if len(r.stmts) != 1 || r.stmts[0] != want {
+		t.Errorf("executed %q, want %q", r.stmts, want)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	cases := []struct {
+		dialect string
+		key     []string
+		update  []string
+		want    string
+	}{
+		{"mysql", []string{"k"}, []string{"a", "b"}, " ON DUPLICATE KEY UPDATE `a`=VALUES(`a`),`b`=VALUES(`b`)"},
+		{"mysql", []string{"k"}, nil, " ON DUPLICATE KEY UPDATE `k`=`k`"},
+		{"postgres", []string{"k1", "k2"}, []string{"a"}, ` ON CONFLICT ("k1","k2") DO UPDATE SET "a"=EXCLUDED."a"`},
+		{"postgres", []string{"k"}, nil, ` ON CONFLICT ("k") DO NOTHING`},
+		{"sqlite", []string{"k"}, []string{"a", "b"}, ` ON CONFLICT ("k") DO UPDATE SET "a"=EXCLUDED."a","b"=EXCLUDED."b"`},
+		{"sqlite", []string{"k"}, nil, ` ON CONFLICT ("k") DO NOTHING`},
+	}
+	for _, c := range cases {
+		if got := dialects[c.dialect].Upsert(c.key, c.update); got != c.want {
+			t.Errorf("%s Upsert(%v, %v) = %q, want %q", c.dialect, c.key, c.update, got, c.want)
+		}
+	}
+}
+
+func TestInsert(t *testing.T) {
+	cases := []struct {
+		dialect string
+		rows    int
+		batches []int //每条语句写入的行数
+		want    string
+	}{
+		{"mysql", 2, []int{2}, "INSERT INTO `t` (`k`,`v`) VALUES (?,?),(?,?) ON DUPLICATE KEY UPDATE `v`=VALUES(`v`)"},
+		{"postgres", 2, []int{2}, `INSERT INTO "t" ("k","v") VALUES ($1,$2),($3,$4) ON CONFLICT ("k") DO UPDATE SET "v"=EXCLUDED."v"`},
+		{"sqlite", 2, []int{2}, `INSERT INTO "t" ("k","v") VALUES (?,?),(?,?) ON CONFLICT ("k") DO UPDATE SET "v"=EXCLUDED."v"`},
+		//每条语句最多500行
+		{"mysql", 1001, []int{500, 500, 1}, ""},
+		//SQLite单条语句最多999个参数
+		{"sqlite", 1000, []int{499, 499, 2}, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.dialect, func(t *testing.T) {
+			db, r := newTestDB(t, dialects[c.dialect], nil, nil)
+			rows := make([][]interface{}, c.rows)
+			for i := range rows {
+				rows[i] = []interface{}{int64(i), "v"}
+			}
+			if err := db.Insert("t", []string{"k", "v"}, rows, []string{"k"}, []string{"v"}); err != nil {
+				t.Fatal(err)
+			}
+			if len(r.stmts) != len(c.batches) {
+				t.Fatalf("executed %d statements, want %d", len(r.stmts), len(c.batches))
+			}
+			if c.want != "" && r.stmts[0] != c.want {
+				t.Errorf("statement = %q, want %q", r.stmts[0], c.want)
+			}
+			var next int64
+			for i, n := range c.batches {
+				if len(r.args[i]) != 2*n {
+					t.Errorf("batch %d has %d args, want %d", i, len(r.args[i]), 2*n)
+					continue
+				}
+				//各批依次写入，不丢行
+				if r.args[i][0] != next {
+					t.Errorf("batch %d starts at row %v, want %d", i, r.args[i][0], next)
+				}
+				next += int64(n)
+			}
+		})
+	}
+}
+
+func TestColumnType(t *testing.T) {
+	types := []data.FieldType{data.TYPE_STRING, data.TYPE_INT, data.TYPE_FLOAT, data.TYPE_BOOL, data.TYPE_TIME, data.TYPE_JSON}
+	want := map[string][]string{
+		"mysql":    {"MEDIUMTEXT", "BIGINT", "DOUBLE", "TINYINT(1)", "DATETIME", "MEDIUMTEXT"},
+		"postgres": {"TEXT", "BIGINT", "DOUBLE PRECISION", "BOOLEAN", "TIMESTAMP", "TEXT"},
+		"sqlite":   {"TEXT", "INTEGER", "REAL", "INTEGER", "DATETIME", "TEXT"},
+	}
+	for name, d := range dialects {
+		for i, ft := range types {
+			if got := d.ColumnType(ft); got != want[name][i] {
+				t.Errorf("%s ColumnType(%v) = %s, want %s", name, ft, got, want[name][i])
+			}
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	cases := []struct {
+		dialect string
+		ident   string
+		want    string
+	}{
+		{"mysql", "a`b", "`a``b`"},
+		{"postgres", `a"b`, `"a""b"`},
+		{"sqlite", "a b", `"a b"`},
+	}
+	for _, c := range cases {
+		if got := dialects[c.dialect].Quote(c.ident); got != c.want {
+			t.Errorf("%s Quote(%q) = %s, want %s", c.dialect, c.ident, got, c.want)
+		}
+	}
+}
+
+func TestIndexName(t *testing.T) {
+	if got := indexName("uk_", "Items", []string{"A", "b"}); got != "uk_items__a_b" {
+		t.Errorf("indexName = %s, want uk_items__a_b", got)
+	}
+	long := strings.Repeat("x", maxIndexName)
+	a, b := indexName("idx_", long, []string{"a"}), indexName("idx_", long, []string{"b"})
+	if len(a) > maxIndexName || a == b {
+		t.Errorf("long index names %s, %s should be hashed and distinct", a, b)
+	}
+}
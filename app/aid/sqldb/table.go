@@ -0,0 +1,285 @@
+package sqldb
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/l-dandelion/gospider/app/pipeline/collector/data"
+)
+
+const maxIndexName = 63 //PostgreSQL标识符的长度上限，MySQL为64
+
+type (
+	//表结构定义
+	Table struct {
+		Name       string
+		Columns    []Column
+		PrimaryKey []string   //主键列，为空时使用自增的id列
+		UniqueKeys [][]string //唯一索引
+		Indexes    [][]string //普通索引
+	}
+
+	Column struct {
+		Name string
+		Type string
+	}
+
+	tableInfo struct {
+		columns map[string]bool
+		indexes map[string]bool
+	}
+)
+
+//建表，或为已有的表补充缺少的列与索引
+func (self *DB) Ensure(t *Table) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	info, ok := self.tables[t.Name]
+	if !ok {
+		var err error
+		if info, err = self.loadTable(t.Name); err != nil {
+			return err
+		}
+		if len(info.columns) == 0 {
+			if err = self.createTable(t); err != nil {
+				return err
+			}
+			for _, c := range t.Columns {
+				info.columns[strings.ToLower(c.Name)] = true
+			}
+		}
+		self.tables[t.Name] = info
+	}
+
+	for _, c := range t.Columns {
+		if info.columns[strings.ToLower(c.Name)] {
+			continue
+		}
+		if _, err := self.Exec("ALTER TABLE " + self.Quote(t.Name) + " ADD COLUMN " + self.Quote(c.Name) + " " + c.Type); err != nil {
+			return err
+		}
+		info.columns[strings.ToLower(c.Name)] = true
+	}
+
+	for name, stmt := range self.indexStmts(t) {
+		if info.indexes[name] {
+			continue
+		}
+		if _, err := self.Exec(stmt); err != nil {
+			return err
+		}
+		info.indexes[name] = true
+	}
+	return nil
+}
+
+func (self *DB) createTable(t *Table) error {
+	var defs []string
+	if len(t.PrimaryKey) == 0 {
+		defs = append(defs, self.AutoId())
+	}
+	for _, c := range t.Columns {
+		defs = append(defs, self.Quote(c.Name)+" "+c.Type)
+	}
+	if len(t.PrimaryKey) > 0 {
+		defs = append(defs, "PRIMARY KEY "+self.columnList(t.PrimaryKey))
+	}
+	_, err := self.Exec("CREATE TABLE IF NOT EXISTS " + self.Quote(t.Name) + " (" + strings.Join(defs, ", ") + ")" + self.TableOptions())
+	return err
+}
+
+//读取已有表的列与索引，表不存在时返回空结构
+func (self *DB) loadTable(table string) (*tableInfo, error) {
+	info := &tableInfo{
+		columns: make(map[string]bool),
+		indexes: make(map[string]bool),
+	}
+	for _, q := range []struct {
+		set  map[string]bool
+		stmt func(string) (string, []interface{})
+	}{
+		{info.columns, self.ColumnsQuery},
+		{info.indexes, self.IndexesQuery},
+	} {
+		query, args := q.stmt(table)
+		rows, err := self.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var name string
+			if err = rows.Scan(&name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			q.set[strings.ToLower(name)] = true
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+//[索引名]建索引语句；索引名含表名，以免在PostgreSQL、SQLite中与其他表冲突
+func (self *DB) indexStmts(t *Table) map[string]string {
+	stmts := make(map[string]string)
+	add := func(prefix string, unique bool, cols []string) {
+		name := indexName(prefix, t.Name, cols)
+		stmt := "CREATE INDEX "
+		if unique {
+			stmt = "CREATE UNIQUE INDEX "
+		}
+		stmts[name] = stmt + self.Quote(name) + " ON " + self.Quote(t.Name) + " " + self.columnList(cols)
+	}
+	for _, cols := range t.UniqueKeys {
+		add("uk_", true, cols)
+	}
+	for _, cols := range t.Indexes {
+		add("idx_", false, cols)
+	}
+	return stmts
+}
+
+func indexName(prefix, table string, cols []string) string {
+	name := prefix + table + "__" + strings.Join(cols, "_")
+	if len(name) > maxIndexName {
+		sum := md5.Sum([]byte(table + "\x00" + strings.Join(cols, "\x00")))
+		name = prefix + hex.EncodeToString(sum[:])
+	}
+	return strings.ToLower(name)
+}
+
+func (self *DB) columnList(cols []string) string {
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = self.Quote(c)
+	}
+	return "(" + strings.Join(quoted, ",") + ")"
+}
+
+/**
+  批量写入，rows中每行的值与columns一一对应
+  upsertKey不为空时，与其冲突的已有行以新值更新update中的列；update为空时保留已有行
+*/
+func (self *DB) Insert(table string, columns []string, rows [][]interface{}, upsertKey, update []string) error {
+	if len(rows) == 0 || len(columns) == 0 {
+		return nil
+	}
+	var suffix string
+	if len(upsertKey) > 0 {
+		suffix = self.Upsert(upsertKey, update)
+	}
+	prefix := "INSERT INTO " + self.Quote(table) + " " + self.columnList(columns) + " VALUES "
+
+	size := self.MaxArgs() / len(columns)
+	if size > 500 {
+		size = 500
+	} else if size < 1 {
+		size = 1
+	}
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for _, row := range rows[start:end] {
+			ph := make([]string, len(columns))
+			for i := range columns {
+				args = append(args, row[i])
+				ph[i] = self.Placeholder(len(args))
+			}
+			values = append(values, "("+strings.Join(ph, ",")+")")
+		}
+		if _, err := self.Exec(prefix+strings.Join(values, ",")+suffix, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//删除column列的值在values中的记录
+func (self *DB) Delete(table, column string, values []interface{}) error {
+	prefix := "DELETE FROM " + self.Quote(table) + " WHERE " + self.Quote(column) + " IN ("
+	size := self.MaxArgs()
+	if size > 500 {
+		size = 500
+	}
+	for start := 0; start < len(values); start += size {
+		end := start + size
+		if end > len(values) {
+			end = len(values)
+		}
+		ph := make([]string, end-start)
+		for i := range ph {
+			ph[i] = self.Placeholder(i + 1)
+		}
+		if _, err := self.Exec(prefix+strings.Join(ph, ",")+")", values[start:end]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//逐行读取表中的指定列，NULL读取为空字符串，表不存在时不读取
+func (self *DB) Select(table string, columns []string, fn func(row []string)) error {
+	info, err := self.loadTable(table)
+	if err != nil || len(info.columns) == 0 {
+		return err
+	}
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = self.Quote(c)
+	}
+	rows, err := self.Query("SELECT " + strings.Join(quoted, ",") + " FROM " + self.Quote(table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	row := make([]string, len(columns))
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			row[i] = v.String
+		}
+		fn(row)
+	}
+	return rows.Err()
+}
+
+//转为写入数据库的参数，空值写入NULL，复合类型写入JSON文本
+func Value(v interface{}, t data.FieldType) interface{} {
+	switch v2 := v.(type) {
+	case nil:
+		return nil
+	case time.Time, bool:
+		return v2
+	case string:
+		if t == data.TYPE_TIME {
+			if tm, err := time.Parse(time.RFC3339Nano, v2); err == nil {
+				return tm
+			}
+		}
+		return v2
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v2
+	}
+	return util.JsonString(v)
+}
+
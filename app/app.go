@@ -0,0 +1,337 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+	"github.com/henrylee2cn/pholcus/runtime/status"
+	"github.com/l-dandelion/gospider/app/aid/dedup"
+	"github.com/l-dandelion/gospider/app/aid/robots"
+	"github.com/l-dandelion/gospider/app/crawler"
+	"github.com/l-dandelion/gospider/app/pipeline"
+	"github.com/l-dandelion/gospider/app/scheduler"
+	"github.com/l-dandelion/gospider/app/spider"
+)
+
+type (
+	App interface {
+		GetSpiderLib() []*spider.Spider              //获取全部已注册的蜘蛛
+		GetSpiderByName(string) *spider.Spider       //通过名字获取已注册的蜘蛛
+		GetSpiderQueue() crawler.SpiderQueue         //获取本次任务的蜘蛛队列
+		SpiderPrepare(original []*spider.Spider) App //指定本次任务要执行的蜘蛛
+		Run(task *cache.AppConf) error               //按任务配置启动采集，非阻塞
+		Pause()                                      //暂停采集
+		Resume()                                     //恢复采集
+		Stop()                                       //终止采集，阻塞至全部蜘蛛退出
+		Wait() *Summary                              //阻塞至任务结束，返回汇总报告
+		LastSummary() *Summary                       //最近一次结束的任务的汇总报告，非阻塞
+		Progress() []*Progress                       //本次任务各蜘蛛的实时进度
+		Status() int                                 //运行状态
+		IsRunning() bool
+		IsPause() bool
+		IsStopped() bool
+	}
+
+	//任务结束后的汇总报告
+	Summary struct {
+		Reports  []*Report     `json:"reports"`  //各蜘蛛的输出报告
+		DataNum  uint64        `json:"dataNum"`  //文本数据总数
+		FileNum  uint64        `json:"fileNum"`  //文件总数
+		PageSucc uint64        `json:"pageSucc"` //成功页数
+		PageFail uint64        `json:"pageFail"` //失败页数
+		Blocked  uint64        `json:"blocked"`  //被robots.txt禁止的请求数
+		DupPages uint64        `json:"dupPages"` //因内容重复而丢弃的页面数
+		DupItems uint64        `json:"dupItems"` //因内容重复而丢弃的结果数据数
+		TakeTime time.Duration `json:"takeTime"` //总耗时，单位纳秒
+	}
+
+	//单个蜘蛛的输出报告
+	Report struct {
+		Spider   string        `json:"spider"`   //蜘蛛名称
+		Keyin    string        `json:"keyin"`    //自定义配置
+		DataNum  uint64        `json:"dataNum"`  //文本数据数
+		FileNum  uint64        `json:"fileNum"`  //文件数
+		TakeTime time.Duration `json:"takeTime"` //耗时，单位纳秒
+	}
+
+	//蜘蛛的实时进度
+	Progress struct {
+		Name     string `json:"name"`     //蜘蛛名称
+		Keyin    string `json:"keyin"`    //自定义配置
+		Started  bool   `json:"started"`  //是否已分配采集引擎
+		QueueLen int    `json:"queueLen"` //待下载请求数
+		ResCount int32  `json:"resCount"` //正在下载的请求数
+		DataNum  uint64 `json:"dataNum"`  //已输出的文本数据数
+		FileNum  uint64 `json:"fileNum"`  //已输出的文件数
+	}
+
+	Logic struct {
+		crawler.SpiderQueue
+		crawler.CrawlerPool
+		selected []*spider.Spider
+		running  map[int]pipeline.Pipeline //[SpiderQueue索引]结果收集管道
+		status   int
+		finish   chan bool
+		summary  *Summary //最近一次结束的任务的汇总报告
+		sync.RWMutex
+	}
+)
+
+//全局唯一的默认实例，scheduler与cache均为全局状态，同一进程内不应同时运行多个任务
+var LogicApp = New()
+
+func New() App {
+	finish := make(chan bool)
+	close(finish)
+	return &Logic{
+		SpiderQueue: crawler.NewSpiderQueue(),
+		CrawlerPool: crawler.NewCrawlerPool(),
+		status:      status.STOPPED,
+		finish:      finish,
+		summary:     &Summary{},
+	}
+}
+
+func (self *Logic) GetSpiderLib() []*spider.Spider {
+	return spider.Species.Get()
+}
+
+func (self *Logic) GetSpiderByName(name string) *spider.Spider {
+	return spider.Species.GetByName(name)
+}
+
+func (self *Logic) GetSpiderQueue() crawler.SpiderQueue {
+	return self.SpiderQueue
+}
+
+func (self *Logic) SpiderPrepare(original []*spider.Spider) App {
+	self.Lock()
+	defer self.Unlock()
+	self.selected = original
+	return self
+}
+
+func (self *Logic) Run(task *cache.AppConf) error {
+	self.Lock()
+	if self.status != status.STOPPED {
+		self.Unlock()
+		return fmt.Errorf("任务正在运行中，请先终止")
+	}
+	if len(self.selected) == 0 {
+		self.Unlock()
+		return fmt.Errorf("本次任务未选择任何蜘蛛")
+	}
+	if task != nil {
+		cache.Task = task
+	}
+
+	self.SpiderQueue.Reset()
+	for _, sp := range self.selected {
+		spcopy := sp.Copy()
+		if spcopy.PauseTime == 0 {
+			spcopy.PauseTime = cache.Task.Pausetime
+		}
+		if spcopy.GetLimit() == spider.LIMIT {
+			spcopy.SetLimit(cache.Task.Limit)
+		} else {
+			spcopy.SetLimit(-1 * cache.Task.Limit)
+		}
+		self.SpiderQueue.Add(spcopy)
+	}
+	self.SpiderQueue.AddKeyins(cache.Task.Keyins)
+
+	self.status = status.RUN
+	self.finish = make(chan bool)
+	self.running = make(map[int]pipeline.Pipeline)
+	self.Unlock()
+
+	count := self.SpiderQueue.Len()
+	cache.ReportChan = make(chan *cache.Report)
+	cache.ResetPageCount()
+	robots.ResetBlocked()
+	dedup.ResetDropped()
+	pipeline.RefreshOutput()
+	scheduler.Init()
+	crawlerCap := self.CrawlerPool.Reset(count)
+
+	logs.Log.Informational(" *     执行任务总数(任务数[*自定义配置数])为 %v 个\n", count)
+	logs.Log.Informational(" *     采集引擎池容量为 %v\n", crawlerCap)
+	logs.Log.Informational(" *     并发协程最多 %v 个\n", cache.Task.ThreadNum)
+	logs.Log.Informational(" *     默认随机停顿 %v~%v 毫秒\n", cache.Task.Pausetime/2, cache.Task.Pausetime*2)
+	logs.Log.App(" *                                                                                                 —— 开始抓取，请耐心等候 ——")
+
+	cache.StartTime = time.Now()
+	go self.goRun(count)
+	return nil
+}
+
+func (self *Logic) Pause() {
+	self.Lock()
+	defer self.Unlock()
+	if self.status != status.RUN {
+		return
+	}
+	self.status = status.PAUSE
+	scheduler.PauseRecover()
+}
+
+func (self *Logic) Resume() {
+	self.Lock()
+	defer self.Unlock()
+	if self.status != status.PAUSE {
+		return
+	}
+	self.status = status.RUN
+	scheduler.PauseRecover()
+}
+
+func (self *Logic) Stop() {
+	self.Lock()
+	if self.status == status.STOPPED {
+		self.Unlock()
+		return
+	}
+	if self.status != status.STOP {
+		self.status = status.STOP
+		self.Unlock()
+		scheduler.Stop()
+		self.CrawlerPool.Stop()
+	} else {
+		self.Unlock()
+	}
+	self.Wait()
+}
+
+func (self *Logic) Wait() *Summary {
+	self.RLock()
+	finish := self.finish
+	self.RUnlock()
+	<-finish
+	self.RLock()
+	defer self.RUnlock()
+	return self.summary
+}
+
+func (self *Logic) LastSummary() *Summary {
+	self.RLock()
+	defer self.RUnlock()
+	return self.summary
+}
+
+func (self *Logic) Progress() []*Progress {
+	self.RLock()
+	defer self.RUnlock()
+	ps := make([]*Progress, 0, self.SpiderQueue.Len())
+	for i, sp := range self.SpiderQueue.GetAll() {
+		p := &Progress{
+			Name:  sp.GetName(),
+			Keyin: sp.GetKeyin(),
+		}
+		if pl, ok := self.running[i]; ok {
+			p.Started = true
+			p.QueueLen = sp.RequestLen()
+			p.ResCount = sp.RequestResCount()
+			p.DataNum = pl.DataNum()
+			p.FileNum = pl.FileNum()
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+func (self *Logic) Status() int {
+	self.RLock()
+	defer self.RUnlock()
+	return self.status
+}
+
+func (self *Logic) IsRunning() bool {
+	return self.Status() == status.RUN
+}
+
+func (self *Logic) IsPause() bool {
+	return self.Status() == status.PAUSE
+}
+
+func (self *Logic) IsStopped() bool {
+	return self.Status() == status.STOPPED
+}
+
+func (self *Logic) goRun(count int) {
+	var i int
+	for i = 0; i < count && self.Status() != status.STOP; i++ {
+		for self.IsPause() {
+			time.Sleep(time.Second)
+		}
+		c := self.CrawlerPool.Use()
+		if c == nil {
+			break
+		}
+		go func(i int, c crawler.Crawler) {
+			c.Init(self.SpiderQueue.GetByIndex(i))
+			self.Lock()
+			self.running[i] = c.GetPipeline()
+			self.Unlock()
+			c.Run()
+			self.RLock()
+			if self.status != status.STOP {
+				self.CrawlerPool.Free(c)
+			}
+			self.RUnlock()
+		}(i, c)
+	}
+
+	summary := &Summary{}
+	for ii := 0; ii < i; ii++ {
+		r := <-cache.ReportChan
+		summary.Reports = append(summary.Reports, &Report{
+			Spider:   r.SpiderName,
+			Keyin:    r.Keyin,
+			DataNum:  r.DataNum,
+			FileNum:  r.FileNum,
+			TakeTime: r.Time,
+		})
+		if r.DataNum == 0 && r.FileNum == 0 {
+			logs.Log.App(" *     [任务小计：%s | KEYIN：%s]   无采集结果，用时 %v！\n", r.SpiderName, r.Keyin, r.Time)
+			continue
+		}
+		logs.Log.Informational(" * ")
+		switch {
+		case r.DataNum > 0 && r.FileNum == 0:
+			logs.Log.App(" *     [任务小计：%s | KEYIN：%s]   共采集数据 %v 条，用时 %v！\n", r.SpiderName, r.Keyin, r.DataNum, r.Time)
+		case r.DataNum == 0 && r.FileNum > 0:
+			logs.Log.App(" *     [任务小计：%s | KEYIN：%s]   共下载文件 %v 个，用时 %v！\n", r.SpiderName, r.Keyin, r.FileNum, r.Time)
+		default:
+			logs.Log.App(" *     [任务小计：%s | KEYIN：%s]   共采集数据 %v 条 + 下载文件 %v 个，用时 %v！\n", r.SpiderName, r.Keyin, r.DataNum, r.FileNum, r.Time)
+		}
+		summary.DataNum += r.DataNum
+		summary.FileNum += r.FileNum
+	}
+
+	summary.PageSucc = cache.GetPageCount(1)
+	summary.PageFail = cache.GetPageCount(-1)
+	summary.Blocked = robots.Blocked()
+	summary.DupPages = dedup.DroppedPages()
+	summary.DupItems = dedup.DroppedItems()
+	summary.TakeTime = time.Since(cache.StartTime)
+
+	logs.Log.Informational(" * ")
+	logs.Log.App(" *     [任务合计] 共采集数据 %v 条 + 下载文件 %v 个，成功页数 %v，失败页数 %v，robots.txt禁止 %v，重复页面 %v，重复数据 %v，用时 %v\n",
+		summary.DataNum, summary.FileNum, summary.PageSucc, summary.PageFail, summary.Blocked, summary.DupPages, summary.DupItems, summary.TakeTime)
+
+	self.Lock()
+	if self.status == status.RUN || self.status == status.PAUSE {
+		self.status = status.STOP
+		self.Unlock()
+		scheduler.Stop()
+		self.CrawlerPool.Stop()
+		self.Lock()
+	}
+	self.summary = summary
+	self.status = status.STOPPED
+	close(self.finish)
+	self.Unlock()
+}
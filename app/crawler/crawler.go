@@ -2,15 +2,25 @@ package crawler
 
 import (
 	"bytes"
+	"errors"
 	"math/rand"
+	"net/url"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/henrylee2cn/pholcus/logs"
 	"github.com/henrylee2cn/pholcus/runtime/cache"
+	"github.com/l-dandelion/gospider/app/aid/dedup"
+	"github.com/l-dandelion/gospider/app/aid/history"
+	"github.com/l-dandelion/gospider/app/aid/metrics"
+	"github.com/l-dandelion/gospider/app/aid/proxy"
+	"github.com/l-dandelion/gospider/app/aid/robots"
+	"github.com/l-dandelion/gospider/app/distribute"
 	"github.com/l-dandelion/gospider/app/downloader"
 	"github.com/l-dandelion/gospider/app/downloader/request"
 	"github.com/l-dandelion/gospider/app/pipeline"
+	"github.com/l-dandelion/gospider/app/scheduler"
 	"github.com/l-dandelion/gospider/app/spider"
 )
 
@@ -21,17 +31,25 @@ type (
 		Stop()
 		CanStop() bool
 		GetId() int
+		GetPipeline() pipeline.Pipeline
 	}
 
 	crawler struct {
-		*spider.Spider                 //执行采集的规则
-		downloader.Downloader          //全局公用的下载器
-		pipeline.Pipeline              //结果收集与输出管道
-		id                    int      //引擎id
-		pause                 [2]int64 //请求间隔
+		*spider.Spider                               //执行采集的规则
+		downloader.Downloader                        //全局公用的下载器
+		pipeline.Pipeline                            //结果收集与输出管道
+		id                    int                    //引擎id
+		pause                 [2]int64               //请求间隔
+		logins                map[string]*loginState //各会话的登录状态
+		loginLock             sync.Mutex
+		requeued              map[string]int //[原因+reqUnique]请求已被放回队列的次数
+		requeueLock           sync.Mutex
 	}
 )
 
+//同一请求因暂时无法处理而放回队列的最大次数，超出后记为失败
+const MAX_REQUEUE = 5
+
 func New(id int) Crawler {
 	return &crawler{
 		id:         id,
@@ -42,6 +60,8 @@ func New(id int) Crawler {
 func (self *crawler) Init(sp *spider.Spider) Crawler {
 	self.Spider = sp.ReqmatrixInit()
 	self.Pipeline = pipeline.New(sp)
+	self.logins = make(map[string]*loginState)
+	self.requeued = make(map[string]int)
 	self.pause[0] = sp.PauseTime / 2
 	if self.pause[0] > 0 {
 		self.pause[1] = self.pause[0] * 3
@@ -59,6 +79,10 @@ func (self *crawler) Run() {
 		self.run()
 		close(c)
 	}()
+	//在RuleTree.Root之前登录全部会话，登录失败的会话在其请求下载时重试
+	if self.Spider.NeedLogin() {
+		self.loginAll()
+	}
 	self.Spider.Start()
 	<-c
 	self.Pipeline.Stop()
@@ -72,7 +96,7 @@ func (self *crawler) Stop() {
 func (self *crawler) run() {
 	for {
 		req := self.GetOne()
-		if req != nil {
+		if req == nil {
 			if self.Spider.CanStop() {
 				break
 			}
@@ -83,6 +107,7 @@ func (self *crawler) run() {
 		go func() {
 			defer func() {
 				self.FreeOne()
+				self.DoneOne(req)
 			}()
 			logs.Log.Debug(" *     Start: %v", req.GetUrl())
 			self.Process(req)
@@ -122,7 +147,21 @@ func (self *crawler) Process(req *request.Request) {
 		}
 	}()
 
-	var ctx = self.Downloader.Download(sp, req)
+	if sp.ObeyRobots && !self.allowedByRobots(req) {
+		return
+	}
+
+	if m := distribute.CurrentMaster(); m != nil {
+		self.processRemote(m, req)
+		return
+	}
+
+	var ctx = self.download(req)
+	if ctx == nil {
+		return
+	}
+	outcome := ctx.ProxyOutcome()
+	scheduler.ReportProxy(req, outcome)
 	if err := ctx.GetError(); err != nil {
 		if sp.DoHistory(req, false) {
 			cache.PageFailCount()
@@ -130,7 +169,47 @@ func (self *crawler) Process(req *request.Request) {
 		logs.Log.Error(" *     Fail  [download][%v]: %v\n", downUrl, err)
 		return
 	}
-	ctx.Parse(req.GetUrl())
+	if outcome == proxy.BANNED {
+		if sp.DoHistory(req, false) {
+			cache.PageFailCount()
+		}
+		logs.Log.Error(" *     Fail  [banned][%v]: 页面含有封禁标志\n", downUrl)
+		spider.PutContext(ctx)
+		return
+	}
+
+	var rec *history.Record
+	if sp.RecrawlTTL > 0 {
+		var (
+			unchanged bool
+			err       error
+		)
+		rec, unchanged, err = ctx.Revisit(sp.LastRecord(req))
+		if err == spider.ErrNoRecord {
+			//不带条件请求头重新下载
+			spider.DropConditional(req)
+			spider.PutContext(ctx)
+			self.requeue(req, 0, "revisit", err)
+			return
+		}
+		if unchanged {
+			sp.DoSuccess(req, rec)
+			cache.PageSuccCount()
+			logs.Log.Informational(" *     Skip  [未变化]: %v\n", downUrl)
+			spider.PutContext(ctx)
+			return
+		}
+	}
+	if sp.DuplicatePage(ctx) {
+		sp.DoSuccess(req, rec)
+		cache.PageSuccCount()
+		dedup.AddDroppedPage()
+		metrics.IncDuplicate(sp.GetName(), "page")
+		logs.Log.Informational(" *     Skip  [重复页面]: %v\n", downUrl)
+		spider.PutContext(ctx)
+		return
+	}
+	ctx.Parse(req.GetRuleName())
 
 	for _, f := range ctx.PullFiles() {
 		if self.Pipeline.CollectFile(f) != nil {
@@ -144,7 +223,7 @@ func (self *crawler) Process(req *request.Request) {
 		}
 	}
 
-	sp.DoHistory(req, true)
+	sp.DoSuccess(req, rec)
 
 	cache.PageSuccCount()
 
@@ -152,6 +231,129 @@ func (self *crawler) Process(req *request.Request) {
 	spider.PutContext(ctx)
 }
 
+//交由工作节点下载并解析，新请求与结果数据仍由本节点调度与输出
+func (self *crawler) processRemote(m *distribute.Master, req *request.Request) {
+	var (
+		downUrl = req.GetUrl()
+		sp      = self.Spider
+	)
+
+	res, err := m.Dispatch(&distribute.Task{
+		Spider:  sp.GetName(),
+		Keyin:   sp.GetKeyin(),
+		Limit:   sp.GetLimit(),
+		Request: req.Serialize(),
+		Proxy:   req.GetProxy(),
+		Recrawl: sp.RecrawlTTL > 0,
+		Last:    sp.LastRecord(req),
+	}, sp.IsStopping)
+	if err == distribute.ErrCanceled {
+		return
+	}
+	if err == nil {
+		scheduler.ReportProxy(req, res.Outcome)
+	}
+	if err == nil && res.Error != "" {
+		err = errors.New(res.Error)
+	}
+	if err != nil {
+		if sp.DoHistory(req, false) {
+			cache.PageFailCount()
+		}
+		logs.Log.Error(" *     Fail  [remote][%v]: %v\n", downUrl, err)
+		return
+	}
+
+	if res.Unchanged {
+		sp.DoSuccess(req, res.Record)
+		cache.PageSuccCount()
+		logs.Log.Informational(" *     Skip  [未变化]: %v\n", downUrl)
+		return
+	}
+
+	for _, s := range res.Requests {
+		newReq, err := request.UnSerialize(s)
+		if err != nil {
+			logs.Log.Error(" *     Fail  [remote][%v]: %v\n", downUrl, err)
+			continue
+		}
+		sp.RequestPush(newReq)
+	}
+
+	for _, f := range res.Files {
+		if self.Pipeline.CollectFile(f.FileCell()) != nil {
+			break
+		}
+	}
+
+	for _, item := range res.Items {
+		if self.Pipeline.CollectData(item.DataCell()) != nil {
+			break
+		}
+	}
+
+	sp.DoSuccess(req, res.Record)
+
+	cache.PageSuccCount()
+
+	logs.Log.Informational(" *     Success: %v\n", downUrl)
+}
+
+/**
+  检查robots.txt，并将Crawl-delay设为该主机的最小请求间隔
+  robots.txt暂时无法获取时，待其可重新获取后将请求放回队列
+*/
+func (self *crawler) allowedByRobots(req *request.Request) bool {
+	allowed, delay, err := robots.Check(req, self.Spider.RobotsUserAgent)
+	if err == robots.ErrUnavailable {
+		self.requeue(req, delay, "robots.txt", err)
+		return false
+	}
+	self.forgetRequeue(req, "robots.txt")
+	if delay > 0 {
+		if u, err := url.Parse(req.GetUrl()); err == nil {
+			scheduler.SetHostMinDelay(u.Host, delay)
+		}
+	}
+	if !allowed {
+		logs.Log.Warning(" *     Skip  [robots.txt][%v]: 已被robots.txt禁止\n", req.GetUrl())
+	}
+	return allowed
+}
+
+/**
+  delay后将暂时无法处理的请求放回队列
+  同一请求放回超过MAX_REQUEUE次时不再等待，记为失败
+*/
+func (self *crawler) requeue(req *request.Request, delay time.Duration, reason string, err error) {
+	key := reason + req.Unique()
+	self.requeueLock.Lock()
+	n := self.requeued[key] + 1
+	if n > MAX_REQUEUE {
+		delete(self.requeued, key)
+	} else {
+		self.requeued[key] = n
+	}
+	self.requeueLock.Unlock()
+
+	if n > MAX_REQUEUE {
+		if self.Spider.DoHistory(req, false) {
+			cache.PageFailCount()
+		}
+		logs.Log.Error(" *     Fail  [%v][%v]: %v，已重试 %v 次\n", reason, req.GetUrl(), err, MAX_REQUEUE)
+		return
+	}
+	logs.Log.Warning(" *     Delay [%v][%v]: %v，%v 后重试\n", reason, req.GetUrl(), err, delay)
+	self.Spider.RequestRequeue(req, delay)
+}
+
+//请求已不再因reason而等待，清除其放回队列的次数
+func (self *crawler) forgetRequeue(req *request.Request, reason string) {
+	self.requeueLock.Lock()
+	delete(self.requeued, reason+req.Unique())
+	self.requeueLock.Unlock()
+}
+
 func (self *crawler) sleep() {
 	sleeptime := self.pause[0] + rand.Int63n(self.pause[1])
 	time.Sleep(time.Duration(sleeptime) * time.Millisecond)
@@ -169,6 +371,10 @@ func (self *crawler) FreeOne() {
 	self.Spider.RequestFree()
 }
 
+func (self *crawler) DoneOne(req *request.Request) {
+	self.Spider.RequestDone(req)
+}
+
 func (self *crawler) SetId(id int) {
 	self.id = id
 }
@@ -176,3 +382,7 @@ func (self *crawler) SetId(id int) {
 func (self *crawler) GetId() int {
 	return self.id
 }
+
+func (self *crawler) GetPipeline() pipeline.Pipeline {
+	return self.Pipeline
+}
@@ -0,0 +1,124 @@
+package crawler
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/l-dandelion/gospider/app/downloader/request"
+	"github.com/l-dandelion/gospider/app/scheduler"
+	"github.com/l-dandelion/gospider/app/spider"
+)
+
+const (
+	//单个请求因登录失效而重新登录并重试的最大次数
+	MAX_RELOGIN = 1
+	//登录失败后，该时长内的其他请求直接沿用失败结果，不再重复登录
+	LOGIN_BACKOFF = 10 * time.Second
+)
+
+//会话的登录状态
+type loginState struct {
+	last   time.Time //上次登录成功的时间
+	failed time.Time //上次登录失败的时间
+	err    error     //上次登录失败的原因
+	sync.Mutex
+}
+
+/**
+  登录指定会话，session为空时登录蜘蛛的默认cookie
+  since之后已有其他请求登录成功时，不再重复登录；
+  登录失败后的LOGIN_BACKOFF内直接返回该失败，期满后再次尝试，retry为距下次尝试的时长
+*/
+func (self *crawler) login(session string, since time.Time) (retry time.Duration, err error) {
+	self.loginLock.Lock()
+	st := self.logins[session]
+	if st == nil {
+		st = &loginState{}
+		self.logins[session] = st
+	}
+	self.loginLock.Unlock()
+
+	st.Lock()
+	defer st.Unlock()
+	if st.last.After(since) {
+		return 0, nil
+	}
+	if st.err != nil && time.Since(st.failed) < LOGIN_BACKOFF {
+		return LOGIN_BACKOFF - time.Since(st.failed), st.err
+	}
+	if st.err = self.doLogin(session); st.err != nil {
+		st.failed = time.Now()
+		return LOGIN_BACKOFF, st.err
+	}
+	st.last = time.Now()
+	logs.Log.Informational(" *     Success [login][%v]: 登录成功\n", session)
+	return 0, nil
+}
+
+//采集开始前登录全部会话
+func (self *crawler) loginAll() {
+	var wg sync.WaitGroup
+	for _, session := range self.Spider.SessionIds() {
+		wg.Add(1)
+		go func(session string) {
+			defer wg.Done()
+			if _, err := self.login(session, time.Time{}); err != nil {
+				logs.Log.Error(" *     Fail  [login][%v]: %v\n", session, err)
+			}
+		}(session)
+	}
+	wg.Wait()
+}
+
+func (self *crawler) doLogin(session string) error {
+	req, err := self.Spider.LoginRequest(session)
+	if err != nil {
+		return err
+	}
+	scheduler.AssignProxy(req)
+	ctx := self.Downloader.Download(self.Spider, req)
+	defer spider.PutContext(ctx)
+	if err := ctx.GetError(); err != nil {
+		return err
+	}
+	if !ctx.LoginVerified() {
+		return errors.New("登录验证未通过")
+	}
+	return nil
+}
+
+/**
+  下载请求
+  需要登录时先登录该请求的会话；响应表明登录已失效时，重新登录后重试
+  登录失败时将请求放回队列，待登录的退避期满后重试，此时返回nil
+*/
+func (self *crawler) download(req *request.Request) *spider.Context {
+	sp := self.Spider
+	if !sp.NeedLogin() {
+		return self.Downloader.Download(sp, req)
+	}
+	if retry, err := self.login(req.Session, time.Time{}); err != nil {
+		self.requeue(req, retry, "login", err)
+		return nil
+	}
+	for n := 0; ; n++ {
+		start := time.Now()
+		ctx := self.Downloader.Download(sp, req)
+		if !ctx.LoginExpired() {
+			self.forgetRequeue(req, "login")
+			return ctx
+		}
+		if n >= MAX_RELOGIN {
+			ctx.SetError(errors.New("登录已失效"))
+			return ctx
+		}
+		logs.Log.Informational(" *     [登录已失效][%v]: 重新登录后重试\n", req.GetUrl())
+		spider.PutContext(ctx)
+		if retry, err := self.login(req.Session, start); err != nil {
+			self.requeue(req, retry, "login", err)
+			return nil
+		}
+	}
+}
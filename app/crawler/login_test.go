@@ -0,0 +1,146 @@
+package crawler
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/l-dandelion/gospider/app/downloader/request"
+	"github.com/l-dandelion/gospider/app/spider"
+)
+
+//按URL路径返回预设响应的下载器，记录各路径的下载次数
+type fakeDownloader struct {
+	responses map[string][]int //[路径]依次返回的状态码，用尽后重复最后一个
+	counts    map[string]int
+	sync.Mutex
+}
+
+func (self *fakeDownloader) Download(sp *spider.Spider, req *request.Request) *spider.Context {
+	self.Lock()
+	path := req.GetUrl()[strings.LastIndex(req.GetUrl(), "/"):]
+	codes := self.responses[path]
+	code := codes[len(codes)-1]
+	if n := self.counts[path]; n < len(codes) {
+		code = codes[n]
+	}
+	self.counts[path]++
+	self.Unlock()
+
+	ctx := spider.GetContext(sp, req)
+	ctx.SetResponse(&http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("page")),
+	})
+	if code >= 500 {
+		ctx.SetError(errors.New(http.StatusText(code)))
+	}
+	return ctx
+}
+
+func newLoginCrawler(t *testing.T, name string, responses map[string][]int) (*crawler, *fakeDownloader) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	sp := (&spider.Spider{
+		Name: name,
+		RuleTree: &spider.RuleTree{
+			Login: &spider.Login{
+				Request:      &request.Request{Url: "http://example.com/login", Rule: "login"},
+				ExpiredCodes: []int{http.StatusUnauthorized},
+			},
+			Root:  func(*spider.Context) {},
+			Trunk: map[string]*spider.Rule{"page": {}},
+		},
+	}).Register().ReqmatrixInit()
+	d := &fakeDownloader{responses: responses, counts: make(map[string]int)}
+	return &crawler{
+		Spider:     sp,
+		Downloader: d,
+		logins:     make(map[string]*loginState),
+		requeued:   make(map[string]int),
+	}, d
+}
+
+func pageRequest(t *testing.T, sp *spider.Spider) *request.Request {
+	req := &request.Request{Spider: sp.GetName(), Url: "http://example.com/page", Rule: "page"}
+	if err := req.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestLoginDownload(t *testing.T) {
+	cases := []struct {
+		name      string
+		login     []int
+		page      []int
+		err       string //下载结果的错误，requeued为true时忽略
+		requeued  bool
+		logins    int
+		downloads int
+	}{
+		{"logged in", []int{200}, []int{200}, "", false, 1, 1},
+		{"expired then relogin", []int{200}, []int{401, 200}, "", false, 2, 2},
+		{"still expired after relogin", []int{200}, []int{401}, "登录已失效", false, 2, 2},
+		{"login fails", []int{500}, []int{200}, "", true, 1, 0},
+		{"relogin fails", []int{200, 500}, []int{401}, "", true, 2, 1},
+	}
+	for i, c := range cases {
+		cr, d := newLoginCrawler(t, "login_test_"+string(rune('a'+i)), map[string][]int{"/login": c.login, "/page": c.page})
+		req := pageRequest(t, cr.Spider)
+		ctx := cr.download(req)
+		switch {
+		case c.requeued:
+			if ctx != nil {
+				t.Errorf("%s: request should be requeued, got a response", c.name)
+			}
+			if cr.requeued["login"+req.Unique()] != 1 {
+				t.Errorf("%s: requeue count = %d, want 1", c.name, cr.requeued["login"+req.Unique()])
+			}
+		case ctx == nil:
+			t.Errorf("%s: request was requeued", c.name)
+		default:
+			var got string
+			if err := ctx.GetError(); err != nil {
+				got = err.Error()
+			}
+			if got != c.err {
+				t.Errorf("%s: error = %q, want %q", c.name, got, c.err)
+			}
+		}
+		if d.counts["/login"] != c.logins || d.counts["/page"] != c.downloads {
+			t.Errorf("%s: %d logins, %d downloads; want %d, %d", c.name, d.counts["/login"], d.counts["/page"], c.logins, c.downloads)
+		}
+	}
+}
+
+//登录退避期内不再重复登录，放回队列超过MAX_REQUEUE次后记为失败
+func TestLoginBackoff(t *testing.T) {
+	cr, d := newLoginCrawler(t, "login_backoff_test", map[string][]int{"/login": {500}, "/page": {200}})
+	req := pageRequest(t, cr.Spider)
+	for i := 0; i <= MAX_REQUEUE; i++ {
+		if ctx := cr.download(req); ctx != nil {
+			t.Fatalf("attempt %d: request should be requeued", i)
+		}
+	}
+	if d.counts["/login"] != 1 {
+		t.Errorf("%d login attempts during backoff, want 1", d.counts["/login"])
+	}
+	if _, ok := cr.requeued["login"+req.Unique()]; ok {
+		t.Error("requeue count should be dropped after giving up")
+	}
+	//已记为失败时再次记录返回false
+	if cr.Spider.DoHistory(req, false) {
+		t.Error("request should have been recorded as failed")
+	}
+}
@@ -22,6 +22,12 @@ type (
 	}
 )
 
+func NewSpiderQueue() SpiderQueue {
+	return &sq{
+		list: []*Spider{},
+	}
+}
+
 func (self *sq) Reset() {
 	self.list = []*Spider{}
 }
@@ -0,0 +1,174 @@
+package distribute
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/l-dandelion/gospider/app/downloader/request"
+	"github.com/l-dandelion/gospider/app/spider"
+)
+
+const testSpider = "distribute_test"
+
+var registerOnce sync.Once
+
+//注册测试蜘蛛：list页面输出标题，并发现一个detail请求
+func registerSpider() {
+	registerOnce.Do(func() {
+		(&spider.Spider{
+			Name: testSpider,
+			RuleTree: &spider.RuleTree{
+				Root: func(*spider.Context) {},
+				Trunk: map[string]*spider.Rule{
+					"list": {
+						ItemFields: []string{"title"},
+						ParseFunc: func(ctx *spider.Context) {
+							ctx.Output(map[string]interface{}{"title": ctx.GetText()})
+							ctx.AddQueue(&request.Request{
+								Url:  strings.Replace(ctx.GetUrl(), "/list", "/detail", 1),
+								Rule: "detail",
+							})
+						},
+					},
+					"detail": {
+						ParseFunc: func(*spider.Context) {},
+					},
+				},
+			},
+		}).Register()
+	})
+}
+
+func newServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "page "+r.URL.Query().Get("p"))
+	}))
+}
+
+func newTask(t *testing.T, rawurl string) *Task {
+	req := &request.Request{Spider: testSpider, Url: rawurl, Rule: "list"}
+	if err := req.Prepare(); err != nil {
+		t.Fatalf("Prepare(%q): %v", rawurl, err)
+	}
+	return &Task{Spider: testSpider, Keyin: spider.KEYIN, Limit: spider.LIMIT, Request: req.Serialize()}
+}
+
+func startMaster(t *testing.T) *Master {
+	m, err := Serve("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func waitWorkers(t *testing.T, m *Master, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Workers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("workers online = %d, want %d", m.Workers(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func checkResult(t *testing.T, res *Result, srvUrl string, p int) {
+	if res.Error != "" {
+		t.Errorf("page %d: %s", p, res.Error)
+		return
+	}
+	if len(res.Items) != 1 || res.Items[0].Data["title"] != fmt.Sprintf("page %d", p) {
+		t.Errorf("page %d: items = %+v", p, res.Items)
+	}
+	if len(res.Requests) != 1 {
+		t.Errorf("page %d: %d new requests, want 1", p, len(res.Requests))
+		return
+	}
+	req, err := request.UnSerialize(res.Requests[0])
+	if err != nil {
+		t.Errorf("page %d: %v", p, err)
+		return
+	}
+	if want := fmt.Sprintf("%s/detail?p=%d", srvUrl, p); req.GetUrl() != want || req.GetRuleName() != "detail" {
+		t.Errorf("page %d: new request %s [%s], want %s [detail]", p, req.GetUrl(), req.GetRuleName(), want)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	registerSpider()
+	srv := newServer()
+	defer srv.Close()
+	m := startMaster(t)
+	defer m.Close()
+
+	for i := 0; i < 3; i++ {
+		go NewWorker(fmt.Sprintf("worker%d", i), m.Addr().String(), 2).Run()
+	}
+	waitWorkers(t, m, 3)
+
+	var wg sync.WaitGroup
+	for p := 0; p < 10; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			res, err := m.Dispatch(newTask(t, fmt.Sprintf("%s/list?p=%d", srv.URL, p)), nil)
+			if err != nil {
+				t.Errorf("page %d: %v", p, err)
+				return
+			}
+			checkResult(t, res, srv.URL, p)
+		}(p)
+	}
+	wg.Wait()
+}
+
+func TestRedispatch(t *testing.T) {
+	registerSpider()
+	srv := newServer()
+	defer srv.Close()
+	m := startMaster(t)
+	defer m.Close()
+
+	//只领取任务、不回复即断开的工作节点
+	c, err := net.Dial("tcp", m.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := newConn(c)
+	if err = dead.send(&Message{Type: MSG_HELLO, Worker: "dead", Capacity: 1}); err != nil {
+		t.Fatal(err)
+	}
+	waitWorkers(t, m, 1)
+
+	done := make(chan *Result, 1)
+	go func() {
+		res, err := m.Dispatch(newTask(t, srv.URL+"/list?p=1"), nil)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- res
+	}()
+
+	dead.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg, err := dead.recv()
+	if err != nil || msg.Type != MSG_TASK {
+		t.Fatalf("dead worker got %+v, %v; want a task", msg, err)
+	}
+	dead.Close()
+	waitWorkers(t, m, 0)
+
+	go NewWorker("alive", m.Addr().String(), 1).Run()
+	select {
+	case res := <-done:
+		if res != nil {
+			checkResult(t, res, srv.URL, 1)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("task was not re-dispatched after the worker disconnected")
+	}
+}
@@ -0,0 +1,312 @@
+package distribute
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/logs"
+)
+
+var (
+	ErrMasterClosed = errors.New("主节点已关闭")
+	ErrCanceled     = errors.New("任务已取消")
+)
+
+type (
+	/**
+	  主节点，持有请求队列与成功记录（由各蜘蛛的Matrix维护）
+	  将请求以任务的形式分配给空闲的工作节点，节点失效时将其未完成的任务重新分配
+	*/
+	Master struct {
+		listener net.Listener
+		workers  map[string]*remoteWorker
+		pending  []*job          //待分配的任务
+		jobs     map[uint64]*job //全部未完成的任务
+		nextId   uint64
+		closed   bool
+		sync.Mutex
+	}
+
+	remoteWorker struct {
+		id       string
+		conn     *conn
+		capacity int
+		running  map[uint64]*job
+	}
+
+	job struct {
+		task     *Task
+		result   chan *Result
+		worker   string //所在工作节点ID，待分配时为空
+		attempts int
+	}
+)
+
+var (
+	master     *Master //当前进程作为主节点时的实例
+	masterLock sync.RWMutex
+)
+
+//监听addr并作为主节点运行
+func Serve(addr string) (*Master, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	self := &Master{
+		listener: l,
+		workers:  make(map[string]*remoteWorker),
+		jobs:     make(map[uint64]*job),
+	}
+	masterLock.Lock()
+	master = self
+	masterLock.Unlock()
+	go self.accept()
+	logs.Log.Informational(" *     主节点已启动: %v\n", l.Addr())
+	return self, nil
+}
+
+//返回当前的主节点，未启动时为nil
+func CurrentMaster() *Master {
+	masterLock.RLock()
+	defer masterLock.RUnlock()
+	return master
+}
+
+func (self *Master) Addr() net.Addr {
+	return self.listener.Addr()
+}
+
+//在线的工作节点数
+func (self *Master) Workers() int {
+	self.Lock()
+	defer self.Unlock()
+	return len(self.workers)
+}
+
+/**
+  分配任务并等待结果
+  canceled返回true时放弃等待，任务若尚未分配则一并撤回
+*/
+func (self *Master) Dispatch(task *Task, canceled func() bool) (*Result, error) {
+	self.Lock()
+	if self.closed {
+		self.Unlock()
+		return nil, ErrMasterClosed
+	}
+	self.nextId++
+	task.Id = self.nextId
+	j := &job{
+		task:   task,
+		result: make(chan *Result, 1),
+	}
+	self.jobs[task.Id] = j
+	self.pending = append(self.pending, j)
+	self.Unlock()
+	self.schedule()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case res, ok := <-j.result:
+			if !ok {
+				return nil, ErrMasterClosed
+			}
+			return res, nil
+		case <-ticker.C:
+			if canceled != nil && canceled() {
+				self.cancel(j)
+				return nil, ErrCanceled
+			}
+		}
+	}
+}
+
+func (self *Master) cancel(j *job) {
+	self.Lock()
+	defer self.Unlock()
+	delete(self.jobs, j.task.Id)
+	for i, p := range self.pending {
+		if p == j {
+			self.pending = append(self.pending[:i], self.pending[i+1:]...)
+			break
+		}
+	}
+	if w := self.workers[j.worker]; w != nil {
+		delete(w.running, j.task.Id)
+	}
+}
+
+//将待分配的任务交给负载最低的空闲节点
+func (self *Master) schedule() {
+	type assignment struct {
+		w *remoteWorker
+		j *job
+	}
+	var assigned []assignment
+
+	self.Lock()
+	for len(self.pending) > 0 {
+		var idle *remoteWorker
+		for _, w := range self.workers {
+			if len(w.running) >= w.capacity {
+				continue
+			}
+			if idle == nil || len(w.running)*idle.capacity < len(idle.running)*w.capacity {
+				idle = w
+			}
+		}
+		if idle == nil {
+			break
+		}
+		j := self.pending[0]
+		self.pending = self.pending[1:]
+		j.worker = idle.id
+		j.attempts++
+		idle.running[j.task.Id] = j
+		assigned = append(assigned, assignment{idle, j})
+	}
+	self.Unlock()
+
+	for _, a := range assigned {
+		if err := a.w.conn.send(&Message{Type: MSG_TASK, Task: a.j.task}); err != nil {
+			//连接异常时关闭，由读协程负责回收任务
+			a.w.conn.Close()
+		}
+	}
+}
+
+func (self *Master) accept() {
+	for {
+		c, err := self.listener.Accept()
+		if err != nil {
+			self.Lock()
+			closed := self.closed
+			self.Unlock()
+			if closed {
+				return
+			}
+			logs.Log.Error(" *     Fail [主节点接受连接]: %v\n", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		go self.serve(newConn(c))
+	}
+}
+
+func (self *Master) serve(c *conn) {
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(HeartbeatTimeout))
+	hello, err := c.recv()
+	if err != nil || hello.Type != MSG_HELLO || hello.Worker == "" {
+		return
+	}
+	w := &remoteWorker{
+		id:       hello.Worker,
+		conn:     c,
+		capacity: hello.Capacity,
+		running:  make(map[uint64]*job),
+	}
+	if w.capacity <= 0 {
+		w.capacity = 1
+	}
+
+	self.Lock()
+	if self.closed {
+		self.Unlock()
+		return
+	}
+	if old := self.workers[w.id]; old != nil {
+		//同一ID重连，旧连接视为失效
+		old.conn.Close()
+		self.release(old)
+	}
+	self.workers[w.id] = w
+	self.Unlock()
+	logs.Log.Informational(" *     [工作节点上线]: %v（并发 %v）\n", w.id, w.capacity)
+	self.schedule()
+
+	//超过HeartbeatTimeout未收到任何消息时读取超时，视为节点失效
+	for {
+		c.SetReadDeadline(time.Now().Add(HeartbeatTimeout))
+		msg, err := c.recv()
+		if err != nil {
+			break
+		}
+		if msg.Type == MSG_RESULT && msg.Result != nil {
+			self.finish(w, msg.Result)
+		}
+	}
+
+	self.Lock()
+	if self.workers[w.id] == w {
+		delete(self.workers, w.id)
+		self.release(w)
+	}
+	self.Unlock()
+	logs.Log.Warning(" *     [工作节点下线]: %v\n", w.id)
+	self.schedule()
+}
+
+func (self *Master) finish(w *remoteWorker, res *Result) {
+	self.Lock()
+	j := w.running[res.TaskId]
+	if j != nil {
+		delete(w.running, res.TaskId)
+		delete(self.jobs, res.TaskId)
+	}
+	self.Unlock()
+	if j != nil {
+		j.result <- res
+	}
+	self.schedule()
+}
+
+//回收失效节点上未完成的任务，须持有锁
+func (self *Master) release(w *remoteWorker) {
+	var requeue []*job
+	for id, j := range w.running {
+		delete(w.running, id)
+		j.worker = ""
+		if j.attempts >= MaxAttempts {
+			delete(self.jobs, id)
+			j.result <- &Result{TaskId: id, Error: "工作节点多次失效，放弃该任务"}
+			continue
+		}
+		requeue = append(requeue, j)
+	}
+	if len(requeue) > 0 {
+		self.pending = append(requeue, self.pending...)
+		logs.Log.Informational(" *     [重新分配任务]: %v 个（来自 %v）\n", len(requeue), w.id)
+	}
+}
+
+//关闭主节点，等待中的任务返回ErrMasterClosed
+func (self *Master) Close() {
+	self.Lock()
+	if self.closed {
+		self.Unlock()
+		return
+	}
+	self.closed = true
+	for _, w := range self.workers {
+		w.conn.Close()
+		w.running = make(map[uint64]*job)
+	}
+	for id, j := range self.jobs {
+		delete(self.jobs, id)
+		close(j.result)
+	}
+	self.pending = nil
+	self.Unlock()
+
+	masterLock.Lock()
+	if master == self {
+		master = nil
+	}
+	masterLock.Unlock()
+	self.listener.Close()
+}
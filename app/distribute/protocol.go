@@ -0,0 +1,140 @@
+package distribute
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/l-dandelion/gospider/app/aid/history"
+	"github.com/l-dandelion/gospider/app/aid/proxy"
+	"github.com/l-dandelion/gospider/app/pipeline/collector/data"
+)
+
+/**
+  主节点与工作节点之间的通信协议
+  基于TCP，每条消息为一行JSON
+  工作节点连接后先发送HELLO，之后定时发送HEARTBEAT；
+  主节点下发TASK，工作节点处理完毕后回复RESULT。
+*/
+const (
+	MSG_HELLO     = "hello"
+	MSG_HEARTBEAT = "heartbeat"
+	MSG_TASK      = "task"
+	MSG_RESULT    = "result"
+)
+
+var (
+	HeartbeatInterval = 5 * time.Second  //工作节点发送心跳的间隔
+	HeartbeatTimeout  = 20 * time.Second //超过该时长未收到心跳，视工作节点为失效
+	MaxAttempts       = 3                //同一任务因节点失效而重新分配的最大次数
+)
+
+type (
+	Message struct {
+		Type     string  `json:"type"`
+		Worker   string  `json:"worker,omitempty"`   //工作节点ID，HELLO时设置
+		Capacity int     `json:"capacity,omitempty"` //工作节点可同时处理的任务数，HELLO时设置
+		Task     *Task   `json:"task,omitempty"`
+		Result   *Result `json:"result,omitempty"`
+	}
+
+	//下发给工作节点的单个请求
+	Task struct {
+		Id      uint64          `json:"id"`
+		Spider  string          `json:"spider"`            //蜘蛛名称
+		Keyin   string          `json:"keyin"`             //自定义配置
+		Limit   int64           `json:"limit"`             //采集上限
+		Request string          `json:"request"`           //序列化后的请求
+		Proxy   string          `json:"proxy"`             //主节点分配的代理IP
+		Recrawl bool            `json:"recrawl,omitempty"` //是否开启重新采集
+		Last    *history.Record `json:"last,omitempty"`    //上次的采集信息，用于判断页面是否变化
+	}
+
+	//工作节点的处理结果
+	Result struct {
+		TaskId    uint64          `json:"taskId"`
+		Error     string          `json:"error,omitempty"` //不为空时表示下载或解析失败
+		Items     []*Item         `json:"items,omitempty"`
+		Files     []*File         `json:"files,omitempty"`
+		Requests  []string        `json:"requests,omitempty"`  //解析出的新请求，已序列化
+		Record    *history.Record `json:"record,omitempty"`    //开启重新采集时本次的采集信息
+		Unchanged bool            `json:"unchanged,omitempty"` //页面未变化，未解析
+		Outcome   proxy.Outcome   `json:"outcome,omitempty"`   //代理的使用结果，反馈给主节点的代理池
+	}
+
+	Item struct {
+		RuleName     string                    `json:"ruleName"`
+		Data         map[string]interface{}    `json:"data"`
+		FieldTypes   map[string]data.FieldType `json:"fieldTypes,omitempty"`
+		Url          string                    `json:"url"`
+		ParentUrl    string                    `json:"parentUrl"`
+		DownloadTime string                    `json:"downloadTime"`
+	}
+
+	File struct {
+		RuleName string `json:"ruleName"`
+		Name     string `json:"name"`
+		Bytes    []byte `json:"bytes"`
+	}
+)
+
+func newItem(cell data.DataCell) *Item {
+	item := &Item{}
+	item.RuleName, _ = cell["RuleName"].(string)
+	item.Data, _ = cell["Data"].(map[string]interface{})
+	item.FieldTypes = cell.FieldTypes()
+	item.Url, _ = cell["Url"].(string)
+	item.ParentUrl, _ = cell["ParentUrl"].(string)
+	item.DownloadTime, _ = cell["DownloadTime"].(string)
+	return item
+}
+
+func (self *Item) DataCell() data.DataCell {
+	cell := data.GetDataCell(self.RuleName, self.Data, self.Url, self.ParentUrl, self.DownloadTime)
+	if self.FieldTypes != nil {
+		cell.SetFieldTypes(self.FieldTypes)
+	}
+	return cell
+}
+
+func newFile(cell data.FileCell) *File {
+	file := &File{}
+	file.RuleName, _ = cell["RuleName"].(string)
+	file.Name, _ = cell["Name"].(string)
+	file.Bytes, _ = cell["Bytes"].([]byte)
+	return file
+}
+
+func (self *File) FileCell() data.FileCell {
+	return data.GetFileCell(self.RuleName, self.Name, self.Bytes)
+}
+
+// JSON行编解码的连接，写操作并发安全
+type conn struct {
+	net.Conn
+	dec  *json.Decoder
+	enc  *json.Encoder
+	lock sync.Mutex
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{
+		Conn: c,
+		dec:  json.NewDecoder(bufio.NewReader(c)),
+		enc:  json.NewEncoder(c),
+	}
+}
+
+func (self *conn) send(msg *Message) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.SetWriteDeadline(time.Now().Add(HeartbeatTimeout))
+	return self.enc.Encode(msg)
+}
+
+func (self *conn) recv() (*Message, error) {
+	msg := new(Message)
+	return msg, self.dec.Decode(msg)
+}
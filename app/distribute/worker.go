@@ -0,0 +1,169 @@
+package distribute
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/l-dandelion/gospider/app/aid/proxy"
+	"github.com/l-dandelion/gospider/app/downloader"
+	"github.com/l-dandelion/gospider/app/downloader/request"
+	"github.com/l-dandelion/gospider/app/spider"
+)
+
+/**
+  工作节点，连接主节点后领取任务
+  在本地下载并解析，将结果数据与新发现的请求交还主节点
+  工作节点须与主节点编译相同的蜘蛛规则
+*/
+type Worker struct {
+	Id       string //节点ID，同一主节点下应唯一
+	Master   string //主节点地址
+	Capacity int    //可同时处理的任务数
+}
+
+func NewWorker(id, masterAddr string, capacity int) *Worker {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &Worker{
+		Id:       id,
+		Master:   masterAddr,
+		Capacity: capacity,
+	}
+}
+
+//连接主节点并处理任务，直到连接断开
+func (self *Worker) Run() error {
+	c, err := net.DialTimeout("tcp", self.Master, HeartbeatTimeout)
+	if err != nil {
+		return err
+	}
+	cn := newConn(c)
+	defer cn.Close()
+
+	if err = cn.send(&Message{Type: MSG_HELLO, Worker: self.Id, Capacity: self.Capacity}); err != nil {
+		return err
+	}
+	logs.Log.Informational(" *     已连接主节点: %v\n", self.Master)
+
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if cn.send(&Message{Type: MSG_HEARTBEAT}) != nil {
+					cn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		msg, err := cn.recv()
+		if err != nil {
+			return err
+		}
+		if msg.Type != MSG_TASK || msg.Task == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(task *Task) {
+			defer wg.Done()
+			res := self.process(task)
+			if err := cn.send(&Message{Type: MSG_RESULT, Result: res}); err != nil {
+				logs.Log.Error(" *     Fail [回复主节点]: %v\n", err)
+			}
+		}(msg.Task)
+	}
+}
+
+//断线后每隔retry重新连接，永不返回
+func (self *Worker) RunForever(retry time.Duration) {
+	for {
+		err := self.Run()
+		logs.Log.Warning(" *     与主节点的连接已断开: %v，%v 后重连\n", err, retry)
+		time.Sleep(retry)
+	}
+}
+
+//下载并解析单个请求，流程同crawler.Process
+func (self *Worker) process(task *Task) (res *Result) {
+	res = &Result{TaskId: task.Id}
+
+	sp := spider.Species.GetByName(task.Spider)
+	if sp == nil {
+		res.Error = "蜘蛛不存在: " + task.Spider
+		return
+	}
+	req, err := request.UnSerialize(task.Request)
+	if err != nil {
+		res.Error = err.Error()
+		return
+	}
+	req.SetProxy(task.Proxy)
+
+	var lock sync.Mutex
+	sp = sp.Copy().SetKeyin(task.Keyin).SetLimit(task.Limit)
+	sp.SetRequestSink(func(r *request.Request) {
+		lock.Lock()
+		res.Requests = append(res.Requests, r.Serialize())
+		lock.Unlock()
+	})
+
+	defer func() {
+		if p := recover(); p != nil {
+			res = &Result{TaskId: task.Id, Error: fmt.Sprintf("%v", p)}
+			logs.Log.Error(" *     Panic  [process][%s]: %v\n", req.GetUrl(), p)
+		}
+	}()
+
+	ctx := downloader.SurfDownloader.Download(sp, req)
+	res.Outcome = ctx.ProxyOutcome()
+	if err := ctx.GetError(); err != nil {
+		res.Error = err.Error()
+		logs.Log.Error(" *     Fail  [download][%v]: %v\n", req.GetUrl(), err)
+		return
+	}
+	if res.Outcome == proxy.BANNED {
+		res.Error = "页面含有封禁标志"
+		logs.Log.Error(" *     Fail  [banned][%v]: 页面含有封禁标志\n", req.GetUrl())
+		spider.PutContext(ctx)
+		return
+	}
+	if task.Recrawl {
+		if res.Record, res.Unchanged, err = ctx.Revisit(task.Last); err != nil {
+			res.Error = err.Error()
+			logs.Log.Error(" *     Fail  [revisit][%v]: %v\n", req.GetUrl(), err)
+			spider.PutContext(ctx)
+			return
+		}
+		if res.Unchanged {
+			spider.PutContext(ctx)
+			logs.Log.Informational(" *     Skip  [未变化]: %v\n", req.GetUrl())
+			return
+		}
+	}
+	ctx.Parse(req.GetRuleName())
+
+	for _, f := range ctx.PullFiles() {
+		res.Files = append(res.Files, newFile(f))
+	}
+	for _, item := range ctx.PullItems() {
+		res.Items = append(res.Items, newItem(item))
+	}
+	spider.PutContext(ctx)
+
+	logs.Log.Informational(" *     Success: %v\n", req.GetUrl())
+	return
+}
@@ -3,21 +3,22 @@ package downloader
 import (
 	"errors"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/henrylee2cn/pholcus/config"
+	"github.com/l-dandelion/gospider/app/aid/metrics"
 	"github.com/l-dandelion/gospider/app/downloader/request"
 	"github.com/l-dandelion/gospider/app/downloader/surfer"
 	"github.com/l-dandelion/gospider/app/spider"
 )
 
-type Surfer struct {
-	surf    surfer.Surfer
-	phantom surfer.Surfer
-}
+type Surfer struct{}
+
+var SurfDownloader = &Surfer{}
 
-var SurfDownloader = &Surfer{
-	surf:    surfer.New(),
-	phantom: surfer.NewPhantom(config.PHANTOMJS, config.PHANTOMJS_TEMP),
+func init() {
+	surfer.SetPhantomPath(config.PHANTOMJS, config.PHANTOMJS_TEMP)
 }
 
 func (self *Surfer) Download(sp *spider.Spider, cReq *request.Request) *spider.Context {
@@ -25,14 +26,16 @@ func (self *Surfer) Download(sp *spider.Spider, cReq *request.Request) *spider.C
 
 	var resp *http.Response
 	var err error
-	switch cReq.GetDownloaderID() {
-	case request.SURF_ID:
-		resp, err = self.surf.Download(cReq)
-	case request.PHANTOM_ID:
-		resp, err = self.phantom.Download(cReq)
+	start := time.Now()
+	resp, err = surfer.Download(cReq)
+
+	var statusCode int
+	if err == nil && resp != nil {
+		statusCode = resp.StatusCode
 	}
+	metrics.ObserveDownload(hostOf(cReq.GetUrl()), statusCode, time.Since(start))
 
-	if resp.StatusCode >= 400 {
+	if err == nil && resp.StatusCode >= 400 {
 		err = errors.New("响应状态 " + resp.Status)
 	}
 
@@ -40,4 +43,10 @@ func (self *Surfer) Download(sp *spider.Spider, cReq *request.Request) *spider.C
 	return ctx
 }
 
-
+func hostOf(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,126 @@
+package request
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+/**
+  URL规范化规则，用于计算请求的唯一识别码
+  规范化结果仅参与去重，实际下载仍使用原始Url
+*/
+type Canonicalizer struct {
+	LowerHost         bool     //协议与主机名转为小写
+	RemoveDefaultPort bool     //去除http的80端口与https的443端口
+	RemoveFragment    bool     //去除#之后的片段标识
+	TrimTrailingSlash bool     //去除路径末尾的/，空路径补为/
+	SortQuery         bool     //按参数名排序查询参数，同名参数保持原有顺序
+	StripParams       []string //需去除的查询参数名，以*结尾时按前缀匹配，如 utm_*
+}
+
+//常用的规范化规则
+var DefaultCanonicalizer = &Canonicalizer{
+	LowerHost:         true,
+	RemoveDefaultPort: true,
+	RemoveFragment:    true,
+	TrimTrailingSlash: true,
+	SortQuery:         true,
+	StripParams:       []string{"utm_*", "spm", "gclid", "fbclid"},
+}
+
+func (self *Canonicalizer) Canonicalize(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+
+	if self.LowerHost {
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+	}
+
+	if self.RemoveDefaultPort {
+		port := u.Port()
+		if (port == "80" && strings.EqualFold(u.Scheme, "http")) || (port == "443" && strings.EqualFold(u.Scheme, "https")) {
+			host := u.Hostname()
+			if strings.Contains(host, ":") {
+				host = "[" + host + "]"
+			}
+			u.Host = host
+		}
+	}
+
+	if self.RemoveFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+
+	if self.TrimTrailingSlash {
+		if u.Path == "" {
+			u.Path = "/"
+		} else if len(u.Path) > 1 && strings.HasSuffix(u.Path, "/") {
+			u.Path = strings.TrimRight(u.Path, "/")
+			if u.Path == "" {
+				u.Path = "/"
+			}
+		}
+		u.RawPath = ""
+	}
+
+	if u.RawQuery != "" && (self.SortQuery || len(self.StripParams) > 0) {
+		u.RawQuery = self.query(u.RawQuery)
+	}
+	if u.RawQuery == "" {
+		u.ForceQuery = false
+	}
+
+	return u.String(), nil
+}
+
+func (self *Canonicalizer) query(rawQuery string) string {
+	type pair struct {
+		key string
+		raw string
+	}
+	var pairs []pair
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		key := raw
+		if i := strings.Index(raw, "="); i >= 0 {
+			key = raw[:i]
+		}
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if self.strip(key) {
+			continue
+		}
+		pairs = append(pairs, pair{key: key, raw: raw})
+	}
+	if self.SortQuery {
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return pairs[i].key < pairs[j].key
+		})
+	}
+	raws := make([]string, len(pairs))
+	for i, p := range pairs {
+		raws[i] = p.raw
+	}
+	return strings.Join(raws, "&")
+}
+
+func (self *Canonicalizer) strip(key string) bool {
+	for _, p := range self.StripParams {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(key, p[:len(p)-1]) {
+				return true
+			}
+		} else if key == p {
+			return true
+		}
+	}
+	return false
+}
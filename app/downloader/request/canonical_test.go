@@ -0,0 +1,71 @@
+package request
+
+import (
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	cases := []struct {
+		name string
+		c    *Canonicalizer
+		in   string
+		want string
+	}{
+		{"scheme and host case", &Canonicalizer{LowerHost: true}, "HTTP://WWW.Example.COM/Path", "http://www.example.com/Path"},
+		{"host case kept", &Canonicalizer{}, "http://WWW.Example.COM/Path", "http://WWW.Example.COM/Path"},
+		{"http default port", &Canonicalizer{RemoveDefaultPort: true}, "http://example.com:80/a", "http://example.com/a"},
+		{"https default port", &Canonicalizer{RemoveDefaultPort: true}, "https://example.com:443/a", "https://example.com/a"},
+		{"non-default port", &Canonicalizer{RemoveDefaultPort: true}, "http://example.com:443/a", "http://example.com:443/a"},
+		{"ipv6 default port", &Canonicalizer{RemoveDefaultPort: true}, "http://[::1]:80/a", "http://[::1]/a"},
+		{"fragment", &Canonicalizer{RemoveFragment: true}, "http://example.com/a#top", "http://example.com/a"},
+		{"fragment kept", &Canonicalizer{}, "http://example.com/a#top", "http://example.com/a#top"},
+		{"query order", &Canonicalizer{SortQuery: true}, "http://example.com/a?b=2&a=1&c=3", "http://example.com/a?a=1&b=2&c=3"},
+		{"same key order kept", &Canonicalizer{SortQuery: true}, "http://example.com/a?b=2&a=9&a=1", "http://example.com/a?a=9&a=1&b=2"},
+		{"tracking params", &Canonicalizer{StripParams: []string{"utm_*", "spm"}}, "http://example.com/a?utm_source=x&id=1&spm=2&utm_medium=y", "http://example.com/a?id=1"},
+		{"only tracking params", &Canonicalizer{StripParams: []string{"utm_*"}}, "http://example.com/a?utm_source=x", "http://example.com/a"},
+		{"trailing slash", &Canonicalizer{TrimTrailingSlash: true}, "http://example.com/a/b/", "http://example.com/a/b"},
+		{"empty path", &Canonicalizer{TrimTrailingSlash: true}, "http://example.com", "http://example.com/"},
+		{"root path", &Canonicalizer{TrimTrailingSlash: true}, "http://example.com/", "http://example.com/"},
+		{"default rules", DefaultCanonicalizer, "HTTPS://Example.com:443/a/?z=1&utm_campaign=c&a=2#frag", "https://example.com/a?a=2&z=1"},
+	}
+	for _, c := range cases {
+		got, err := c.c.Canonicalize(c.in)
+		if err != nil {
+			t.Errorf("%s: Canonicalize(%q) error: %v", c.name, c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: Canonicalize(%q) = %q, want %q", c.name, c.in, got, c.want)
+		}
+	}
+}
+
+func TestCanonicalizeError(t *testing.T) {
+	if _, err := DefaultCanonicalizer.Canonicalize("http://[::1"); err == nil {
+		t.Error("Canonicalize of an invalid URL should fail")
+	}
+}
+
+func TestUniqueCanonical(t *testing.T) {
+	unique := func(rawurl string, c *Canonicalizer) string {
+		req := &Request{Spider: "spider", Rule: "rule", Url: rawurl}
+		if err := req.SetCanonicalizer(c).Prepare(); err != nil {
+			t.Fatalf("Prepare(%q): %v", rawurl, err)
+		}
+		return req.Unique()
+	}
+
+	a := unique("HTTP://Example.com:80/list/?page=2&utm_source=feed&sort=new#comments", DefaultCanonicalizer)
+	b := unique("http://example.com/list?sort=new&page=2", DefaultCanonicalizer)
+	if a != b {
+		t.Errorf("equivalent URLs have different Unique: %s != %s", a, b)
+	}
+	if c := unique("http://example.com/list?sort=new&page=3", DefaultCanonicalizer); c == b {
+		t.Error("different queries have the same Unique")
+	}
+
+	//未设置规范化规则时按原始Url计算
+	if unique("http://example.com/list/", nil) == unique("http://example.com/list", nil) {
+		t.Error("URLs without a canonicalizer should not be merged")
+	}
+}
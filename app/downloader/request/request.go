@@ -4,6 +4,7 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/l-dandelion/gospider/app/downloader/surfer"
 )
 
 /**
@@ -20,10 +22,12 @@ type Request struct {
 	Spider        string          //规则名，自动设置，禁止人为填写
 	Url           string          //目标URL，必须设置
 	Rule          string          //用于解析响应的规则节点名，必须设置
-	Method        string          //GET POST POST-M HEAD
+	Method        string          //GET POST POST-M HEAD PUT PATCH DELETE OPTIONS
 	Header        http.Header     //请求头信息
 	EnableCookie  bool            //是否使用cookies，在spider的EnableCookie设置
 	PostData      string          //POST values
+	Body          []byte          //原始请求体，如JSON、XML或二进制数据，设置后优先于PostData
+	Files         []FormFile      //multipart表单中的文件，与PostData中的字段一同提交
 	DialTimeout   time.Duration   //创建连接超时 dial tcp: i/o timeout
 	ConnTimeout   time.Duration   //连接状态超时 WASRecv tcp: i/o timeout
 	TryTimes      int             //尝试下载的最大次数
@@ -33,19 +37,32 @@ type Request struct {
 	TempIsJson    map[string]bool //将Temp中以JSON存储的字段标记为true，自动设置，禁止人为填写
 	Priority      int             //指定调度优先级，默认为0（最小优先级为0）
 	Reloadable    bool            //是否允许重复该链接下载
+	HostLimit     int             //同一主机的最大并发数，大于0时覆盖蜘蛛设置
+	HostDelay     time.Duration   //同一主机两次请求的最小间隔，大于0时覆盖蜘蛛设置
+	Session       string          //会话ID，同一会话的请求共用cookie、User-Agent与代理；为空时由蜘蛛分配
+	CookieScope   string          //cookie的隔离范围，自动设置，禁止人为填写
 
 	/**
 	  Surfer下载器内核ID
 	  0为Surf高并发下载器，各种控制功能齐全
 	  1为PhantomJs下载器，特点破防力强，速度慢，低并发
+	  其他内核需先通过surfer.Register注册
 	*/
 	DownloaderID int
+	Downloader   string //下载器内核名称，设置后优先于DownloaderID
+
+	Canonical string //规范化后的Url，用于计算唯一识别码，自动设置，禁止人为填写
+
+	canonicalizer *Canonicalizer //URL规范化规则，在spider的Canonicalizer设置
 
 	proxy  string //当用户界面设置可使用代理ip时，自动设置代理
 	unique string //ID
 	lock   sync.RWMutex
 }
 
+//multipart表单中的文件
+type FormFile = surfer.FormFile
+
 const (
 	DefaultDialTimeout = 2 * time.Minute //默认请求服务器超时实践
 	DefaultConnTimeout = 2 * time.Minute //默认下载超时
@@ -54,8 +71,8 @@ const (
 )
 
 const (
-	SURF_ID    = 0 //默认的surf下载内核（Go原生），此值不可改动
-	PHANTOM_ID = 1 //备用的phantomjs下载内核，一般不使用（效率差，头信息支持不完善）
+	SURF_ID    = surfer.SurfID      //默认的surf下载内核（Go原生），此值不可改动
+	PHANTOM_ID = surfer.PhomtomJsID //备用的phantomjs下载内核，一般不使用（效率差，头信息支持不完善）
 )
 
 /**
@@ -63,14 +80,19 @@ const (
   Request.Url 与 Request.Rule 必须设置
   Request.Spider无需手动设置（由系统自动设置）
   Request.EnableCookie 在 Spider 字段中统一设置，规则请求中指定无效
+  Request.Canonical 由 Spider 的 Canonicalizer 自动生成，为空时以Url计算唯一识别码
   以下字段有默认值，可不设置：
   Request.Method 默认为Get方法；
+  Request.Body 设置后作为原始请求体发送，Content-Type以Header中的为准，未设置时根据内容推断；
+  Request.Files 设置后以multipart提交，PostData中的字段作为普通表单项；
   Request.DialTimeout 默认为常量DefaultDialTimeout，小于0时不限制等待响应时长；
   Request.ConnTimeout 默认为常量DefaultConnTimeout，小于0时不限制下载超时；
   Request.TryTimes 默认为常量DefaultTryTimes，小于0时不限制失败重载次数；
   Request.RedirectTimes 默认不限制重定向次数，小于0时可禁止重定向跳转；
   Request.RetryPause默认为常量DefaultRetryPause；
-  Request.DownloaderID指定下载器ID，0表示默认的Surf高并发下载器，1为PhantomJs下载器，特点破防力强，速度慢，低并发。
+  Request.DownloaderID指定下载器ID，0表示默认的Surf高并发下载器，1为PhantomJs下载器，特点破防力强，速度慢，低并发；
+  Request.Downloader按名称指定下载器，设置后覆盖DownloaderID；下载器未注册时返回错误。
+  Request.Session为空时沿用父请求的会话，父请求也没有会话时由蜘蛛的会话池分配。
 */
 func (self *Request) Prepare() error {
 	//确保url正确，且和Request中Url字符串相等
@@ -81,6 +103,12 @@ func (self *Request) Prepare() error {
 		self.Url = URL.String()
 	}
 
+	if self.canonicalizer != nil {
+		if self.Canonical, err = self.canonicalizer.Canonicalize(self.Url); err != nil {
+			return err
+		}
+	}
+
 	if self.Method == "" {
 		self.Method = "GET"
 	} else {
@@ -115,8 +143,14 @@ func (self *Request) Prepare() error {
 		self.Priority = 0
 	}
 
-	if self.DownloaderID < SURF_ID || self.DownloaderID > PHANTOM_ID {
-		self.DownloaderID = SURF_ID
+	if self.Downloader != "" {
+		id, ok := surfer.DownloaderID(self.Downloader)
+		if !ok {
+			return fmt.Errorf("下载器 %s 未注册: %s", self.Downloader, self.Url)
+		}
+		self.DownloaderID = id
+	} else if !surfer.IsRegistered(self.DownloaderID) {
+		return fmt.Errorf("下载器ID %d 未注册: %s", self.DownloaderID, self.Url)
 	}
 
 	if self.TempIsJson == nil {
@@ -156,8 +190,22 @@ func (self *Request) Serialize() string {
 func (self *Request) Unique() string {
 	if self.unique == "" {
 		// --新增postdata 否则，同一表单不同参数会出现同一标识码
-		block := md5.Sum([]byte(self.Spider + self.Rule + self.Url + self.Method + self.PostData))
-		self.unique = hex.EncodeToString(block[:])
+		u := self.Url
+		if self.Canonical != "" {
+			u = self.Canonical
+		}
+		h := md5.New()
+		h.Write([]byte(self.Spider + self.Rule + u + self.Method + self.PostData))
+		//原始请求体与文件不同的请求视为不同请求，各部分前写入长度，以免拼接后相同
+		if len(self.Body) > 0 || len(self.Files) > 0 {
+			fmt.Fprintf(h, "\x00%d:", len(self.Body))
+			h.Write(self.Body)
+			for _, f := range self.Files {
+				fmt.Fprintf(h, "\x00%d:%s%d:%s%d:", len(f.Field), f.Field, len(f.Name), f.Name, len(f.Data))
+				h.Write(f.Data)
+			}
+		}
+		self.unique = hex.EncodeToString(h.Sum(nil))
 	}
 	return self.unique
 }
@@ -199,6 +247,11 @@ func (self *Request) SetUrl(url string) *Request {
 	return self
 }
 
+func (self *Request) SetCanonicalizer(c *Canonicalizer) *Request {
+	self.canonicalizer = c
+	return self
+}
+
 func (self *Request) GetReferer() string {
 	return self.Header.Get("Referer")
 }
@@ -212,6 +265,37 @@ func (self *Request) GetPostData() string {
 	return self.PostData
 }
 
+func (self *Request) GetBody() []byte {
+	return self.Body
+}
+
+//设置原始请求体，contentType为空时根据内容推断
+func (self *Request) SetBody(body []byte, contentType string) *Request {
+	self.Body = body
+	if contentType != "" {
+		if self.Header == nil {
+			self.Header = make(http.Header)
+		}
+		self.Header.Set("Content-Type", contentType)
+	}
+	return self
+}
+
+func (self *Request) GetFiles() []FormFile {
+	return self.Files
+}
+
+//添加multipart表单中的文件，contentType为空时为application/octet-stream
+func (self *Request) AddFile(field, name, contentType string, data []byte) *Request {
+	self.Files = append(self.Files, FormFile{
+		Field:       field,
+		Name:        name,
+		ContentType: contentType,
+		Data:        data,
+	})
+	return self
+}
+
 func (self *Request) GetHeader() http.Header {
 	return self.Header
 }
@@ -352,6 +436,53 @@ func (self *Request) SetPriority(priority int) *Request {
 	return self
 }
 
+func (self *Request) GetHostLimit() int {
+	return self.HostLimit
+}
+
+func (self *Request) SetHostLimit(limit int) *Request {
+	self.HostLimit = limit
+	return self
+}
+
+func (self *Request) GetHostDelay() time.Duration {
+	return self.HostDelay
+}
+
+func (self *Request) SetHostDelay(delay time.Duration) *Request {
+	self.HostDelay = delay
+	return self
+}
+
+/**
+  会话在下载器中的ID
+  会话按cookie的隔离范围区分，未设置会话时返回空字符串
+*/
+func (self *Request) GetSession() string {
+	if self.Session == "" {
+		return ""
+	}
+	return self.GetCookieScope() + "/" + self.Session
+}
+
+//cookie的隔离范围，未设置时按蜘蛛隔离
+func (self *Request) GetCookieScope() string {
+	if self.CookieScope == "" {
+		return self.Spider
+	}
+	return self.CookieScope
+}
+
+func (self *Request) SetCookieScope(scope string) *Request {
+	self.CookieScope = scope
+	return self
+}
+
+func (self *Request) SetSession(session string) *Request {
+	self.Session = session
+	return self
+}
+
 func (self *Request) GetDownloaderID() int {
 	return self.DownloaderID
 }
@@ -361,6 +492,15 @@ func (self *Request) SetDownloaderID(id int) *Request {
 	return self
 }
 
+func (self *Request) GetDownloader() string {
+	return self.Downloader
+}
+
+func (self *Request) SetDownloader(name string) *Request {
+	self.Downloader = name
+	return self
+}
+
 func (self *Request) MarshalJSON() ([]byte, error) {
 	for k, v := range self.Temp {
 		if self.TempIsJson[k] {
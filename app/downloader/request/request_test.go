@@ -0,0 +1,96 @@
+package request
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newRequest(t *testing.T, req *Request) *Request {
+	if req.Url == "" {
+		req.Url = "http://example.com/api"
+	}
+	req.Spider, req.Rule = "spider", "rule"
+	if err := req.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestSerializeBody(t *testing.T) {
+	binary := []byte{0, 1, 2, 0xff, '"', '\\', '\n'}
+	cases := []struct {
+		name string
+		req  *Request
+	}{
+		{"json body", (&Request{Method: "POST"}).SetBody([]byte(`{"a":1,"b":"x&y"}`), "application/json")},
+		{"binary body", (&Request{Method: "PUT"}).SetBody(binary, "")},
+		{"files", (&Request{Method: "POST-M", PostData: "k=v"}).
+			AddFile("f1", "a.txt", "text/plain", []byte("hello")).
+			AddFile("f2", "b.bin", "", binary)},
+		{"empty file", (&Request{Method: "POST-M"}).AddFile("f", "empty", "", nil)},
+		{"no body", &Request{Method: "DELETE"}},
+	}
+	for _, c := range cases {
+		req := newRequest(t, c.req)
+		got, err := UnSerialize(req.Serialize())
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got.Method != req.Method || !bytes.Equal(got.Body, req.Body) || got.Header.Get("Content-Type") != req.Header.Get("Content-Type") {
+			t.Errorf("%s: got %s %q, want %s %q", c.name, got.Method, got.Body, req.Method, req.Body)
+		}
+		if len(got.Files) != len(req.Files) {
+			t.Fatalf("%s: %d files, want %d", c.name, len(got.Files), len(req.Files))
+		}
+		for i, f := range req.Files {
+			g := got.Files[i]
+			if g.Field != f.Field || g.Name != f.Name || g.ContentType != f.ContentType || !bytes.Equal(g.Data, f.Data) {
+				t.Errorf("%s: file %d = %+v, want %+v", c.name, i, g, f)
+			}
+		}
+		if got.Unique() != req.Unique() {
+			t.Errorf("%s: Unique changed after round trip", c.name)
+		}
+		//副本同样保留请求体与文件
+		if cp := req.Copy(); !bytes.Equal(cp.Body, req.Body) || len(cp.Files) != len(req.Files) {
+			t.Errorf("%s: Copy lost the body or files", c.name)
+		}
+	}
+}
+
+func TestUnique(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b *Request
+		same bool
+	}{
+		{"same body", (&Request{Method: "POST"}).SetBody([]byte("x"), ""), (&Request{Method: "POST"}).SetBody([]byte("x"), "text/plain"), true},
+		{"different body", (&Request{Method: "POST"}).SetBody([]byte("x"), ""), (&Request{Method: "POST"}).SetBody([]byte("y"), ""), false},
+		{"body and no body", (&Request{Method: "POST"}).SetBody([]byte("x"), ""), &Request{Method: "POST"}, false},
+		{"body vs postdata", (&Request{Method: "POST", PostData: "a"}).SetBody([]byte("b"), ""), &Request{Method: "POST", PostData: "ab"}, false},
+		{"method", &Request{Method: "PUT"}, &Request{Method: "PATCH"}, false},
+		{"method case", &Request{Method: "put"}, &Request{Method: "PUT"}, true},
+		{"file data", (&Request{Method: "POST-M"}).AddFile("f", "a", "", []byte("1")), (&Request{Method: "POST-M"}).AddFile("f", "a", "", []byte("2")), false},
+		{"file name", (&Request{Method: "POST-M"}).AddFile("f", "a", "", nil), (&Request{Method: "POST-M"}).AddFile("f", "b", "", nil), false},
+		{"field and name split", (&Request{Method: "POST-M"}).AddFile("ab", "c", "", nil), (&Request{Method: "POST-M"}).AddFile("a", "bc", "", nil), false},
+		{"name and data split", (&Request{Method: "POST-M"}).AddFile("f", "a", "", []byte("b")), (&Request{Method: "POST-M"}).AddFile("f", "ab", "", nil), false},
+		{"body and file split", (&Request{Method: "POST-M"}).SetBody([]byte("f"), "").AddFile("", "", "", nil), (&Request{Method: "POST-M"}).AddFile("f", "", "", nil), false},
+		{"file order", (&Request{Method: "POST-M"}).AddFile("a", "", "", nil).AddFile("b", "", "", nil), (&Request{Method: "POST-M"}).AddFile("b", "", "", nil).AddFile("a", "", "", nil), false},
+		{"file content type ignored", (&Request{Method: "POST-M"}).AddFile("f", "a", "text/plain", nil), (&Request{Method: "POST-M"}).AddFile("f", "a", "", nil), true},
+		{"canonical url", &Request{Url: "http://example.com/a?b=2&a=1", canonicalizer: &Canonicalizer{SortQuery: true}}, &Request{Url: "http://example.com/a?a=1&b=2"}, true},
+	}
+	for _, c := range cases {
+		a, b := newRequest(t, c.a), newRequest(t, c.b)
+		if same := a.Unique() == b.Unique(); same != c.same {
+			t.Errorf("%s: same unique = %v, want %v", c.name, same, c.same)
+		}
+	}
+}
+
+//没有请求体与文件的请求，其识别码与加入请求体前一致，已有的历史记录仍然有效
+func TestUniqueWithoutBody(t *testing.T) {
+	req := newRequest(t, &Request{Method: "POST", PostData: "a=1"})
+	if want := "97f7b8c599f3417471223398d590ed73"; req.Unique() != want {
+		t.Errorf("Unique() = %s, want %s", req.Unique(), want)
+	}
+}
@@ -208,7 +208,7 @@ func init() {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	idx := r.Intn(l)
 	UserAgents["all"][0], UserAgents["all"][idx] = UserAgents["all"][idx], UserAgents["all"][0]
-	UserAgents["commom"][0], UserAgents["common"][idx] = UserAgents["common"][idx], UserAgents["common"][idx]
+	UserAgents["common"][0], UserAgents["common"][idx] = UserAgents["common"][idx], UserAgents["common"][0]
 }
 
 func CreateReal() string {
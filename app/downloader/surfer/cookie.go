@@ -0,0 +1,357 @@
+package surfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+  可保存的cookie罐
+  在标准库cookiejar的基础上记录收到的全部cookie，以便写入磁盘并在下次启动时恢复
+*/
+type Jar struct {
+	jar     *cookiejar.Jar
+	records map[string]*CookieRecord
+	sync.Mutex
+}
+
+/**
+  cookie的保存格式，字段与浏览器插件（如EditThisCookie）导出的JSON一致
+*/
+type CookieRecord struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value"`
+	Domain   string  `json:"domain"`
+	Path     string  `json:"path"`
+	Expires  float64 `json:"expirationDate,omitempty"` //过期时间，Unix秒，为0时是会话cookie
+	Secure   bool    `json:"secure,omitempty"`
+	HttpOnly bool    `json:"httpOnly,omitempty"`
+	HostOnly bool    `json:"hostOnly,omitempty"` //仅发送给Domain本身，不含子域名
+}
+
+//保存到磁盘的cookie文件，含蜘蛛的cookie罐与各会话的cookie罐
+type cookieFile struct {
+	Jar      []CookieRecord            `json:"jar"`
+	Sessions map[string][]CookieRecord `json:"sessions,omitempty"`
+}
+
+var jars = struct {
+	m     map[string]*Jar
+	seeds map[string][]CookieRecord //各隔离范围的初始cookie，新建会话时载入
+	refs  map[string]int            //各隔离范围的使用者数量
+	sync.Mutex
+}{
+	m:     make(map[string]*Jar),
+	seeds: make(map[string][]CookieRecord),
+	refs:  make(map[string]int),
+}
+
+func NewJar() *Jar {
+	jar, _ := cookiejar.New(nil)
+	return &Jar{
+		jar:     jar,
+		records: make(map[string]*CookieRecord),
+	}
+}
+
+func (self *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	self.jar.SetCookies(u, cookies)
+
+	self.Lock()
+	defer self.Unlock()
+	now := time.Now()
+	for _, c := range cookies {
+		rec := &CookieRecord{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   strings.TrimPrefix(strings.ToLower(c.Domain), "."),
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+		if rec.Domain == "" {
+			rec.Domain = strings.ToLower(u.Hostname())
+			rec.HostOnly = true
+		}
+		if rec.Path == "" || rec.Path[0] != '/' {
+			rec.Path = defaultPath(u.Path)
+		}
+		key := rec.Domain + ";" + rec.Path + ";" + rec.Name
+		switch {
+		case c.MaxAge < 0:
+			delete(self.records, key)
+			continue
+		case c.MaxAge > 0:
+			rec.Expires = float64(now.Add(time.Duration(c.MaxAge) * time.Second).Unix())
+		case !c.Expires.IsZero():
+			if !c.Expires.After(now) {
+				delete(self.records, key)
+				continue
+			}
+			rec.Expires = float64(c.Expires.Unix())
+		}
+		self.records[key] = rec
+	}
+}
+
+func (self *Jar) Cookies(u *url.URL) []*http.Cookie {
+	return self.jar.Cookies(u)
+}
+
+//载入cookie，已过期的将被忽略
+func (self *Jar) Load(records []CookieRecord) {
+	now := float64(time.Now().Unix())
+	for _, rec := range records {
+		if rec.Expires > 0 && rec.Expires <= now {
+			continue
+		}
+		domain := strings.TrimPrefix(rec.Domain, ".")
+		p := rec.Path
+		if p == "" {
+			p = "/"
+		}
+		u := &url.URL{Scheme: "http", Host: domain, Path: p}
+		if rec.Secure {
+			u.Scheme = "https"
+		}
+		c := &http.Cookie{
+			Name:     rec.Name,
+			Value:    rec.Value,
+			Path:     p,
+			Secure:   rec.Secure,
+			HttpOnly: rec.HttpOnly,
+		}
+		if !rec.HostOnly {
+			c.Domain = domain
+		}
+		if rec.Expires > 0 {
+			c.Expires = time.Unix(int64(rec.Expires), 0)
+		}
+		self.SetCookies(u, []*http.Cookie{c})
+	}
+}
+
+//当前未过期的全部cookie
+func (self *Jar) Records() []CookieRecord {
+	self.Lock()
+	defer self.Unlock()
+	now := float64(time.Now().Unix())
+	records := make([]CookieRecord, 0, len(self.records))
+	for _, rec := range self.records {
+		if rec.Expires > 0 && rec.Expires <= now {
+			continue
+		}
+		records = append(records, *rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Name < b.Name
+	})
+	return records
+}
+
+//获取该隔离范围的cookie罐，不存在时创建
+func GetJar(scope string) *Jar {
+	jars.Lock()
+	defer jars.Unlock()
+	jar := jars.m[scope]
+	if jar == nil {
+		jar = NewJar()
+		jar.Load(jars.seeds[scope])
+		jars.m[scope] = jar
+	}
+	return jar
+}
+
+/**
+  登记该隔离范围的一个使用者，如共用同一范围的多个蜘蛛副本
+  返回是否为首个使用者，首个使用者负责载入初始cookie
+*/
+func AcquireJar(scope string) bool {
+	jars.Lock()
+	defer jars.Unlock()
+	jars.refs[scope]++
+	return jars.refs[scope] == 1
+}
+
+/**
+  注销该隔离范围的一个使用者
+  返回是否为最后一个使用者，最后一个使用者负责保存cookie并调用CloseJar
+*/
+func ReleaseJar(scope string) bool {
+	jars.Lock()
+	defer jars.Unlock()
+	if jars.refs[scope] > 1 {
+		jars.refs[scope]--
+		return false
+	}
+	delete(jars.refs, scope)
+	return true
+}
+
+//移除该隔离范围的cookie罐及其下的全部会话
+func CloseJar(scope string) {
+	jars.Lock()
+	delete(jars.m, scope)
+	delete(jars.seeds, scope)
+	jars.Unlock()
+	CloseSessions(scope + "/")
+}
+
+/**
+  以cookie文件作为该隔离范围的初始cookie
+  文件可为Netscape格式的cookies.txt，或浏览器插件导出的JSON数组；
+  蜘蛛的cookie罐与此后新建的会话都会载入这些cookie
+*/
+func SeedCookies(scope string, fileName string) (int, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+	var records []CookieRecord
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		err = json.Unmarshal(b, &records)
+	} else {
+		records, err = parseNetscape(b)
+	}
+	if err != nil {
+		return 0, err
+	}
+	jars.Lock()
+	jars.seeds[scope] = append(jars.seeds[scope], records...)
+	jar := jars.m[scope]
+	jars.Unlock()
+	if jar != nil {
+		jar.Load(records)
+	}
+	return len(records), nil
+}
+
+/**
+  从SaveCookies保存的文件恢复该隔离范围的cookie罐与各会话
+  文件不存在时返回nil
+*/
+func LoadCookies(scope string, fileName string) error {
+	b, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var f cookieFile
+	if err = json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+	GetJar(scope).Load(f.Jar)
+	for id, records := range f.Sessions {
+		GetSession(scope + "/" + id).Jar().Load(records)
+	}
+	return nil
+}
+
+//将该隔离范围的cookie罐与各会话写入文件
+func SaveCookies(scope string, fileName string) error {
+	var f = cookieFile{Jar: []CookieRecord{}}
+
+	jars.Lock()
+	jar := jars.m[scope]
+	jars.Unlock()
+	if jar != nil {
+		f.Jar = jar.Records()
+	}
+
+	prefix := scope + "/"
+	sessions.Lock()
+	for id, sess := range sessions.m {
+		if !strings.HasPrefix(id, prefix) {
+			continue
+		}
+		if records := sess.Jar().Records(); len(records) > 0 {
+			if f.Sessions == nil {
+				f.Sessions = make(map[string][]CookieRecord)
+			}
+			f.Sessions[strings.TrimPrefix(id, prefix)] = records
+		}
+	}
+	sessions.Unlock()
+
+	b, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(fileName), 0777); err != nil {
+		return err
+	}
+	//先写临时文件再替换，避免中断时损坏原文件
+	tmp := fileName + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fileName)
+}
+
+/**
+  解析Netscape格式的cookies.txt
+  每行以Tab分隔：域名、是否包含子域名、路径、是否仅https、过期时间、名称、值
+*/
+func parseNetscape(b []byte) ([]CookieRecord, error) {
+	var records []CookieRecord
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		//值为空时行末是Tab，不能去掉
+		line := strings.TrimLeft(strings.TrimRight(scanner.Text(), "\r"), " ")
+		var httpOnly bool
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+			httpOnly = true
+		} else if strings.TrimSpace(line) == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			continue
+		}
+		rec := CookieRecord{
+			Domain:   strings.TrimPrefix(fields[0], "."),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		rec.Expires, _ = strconv.ParseFloat(fields[4], 64)
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+//RFC 6265 5.1.4 中的默认路径
+func defaultPath(p string) string {
+	if p == "" || p[0] != '/' {
+		return "/"
+	}
+	if dir := path.Dir(p); dir != "." {
+		return dir
+	}
+	return "/"
+}
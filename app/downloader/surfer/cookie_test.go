@@ -0,0 +1,238 @@
+package surfer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var future = float64(time.Now().Add(24 * time.Hour).Unix())
+
+func TestParseNetscape(t *testing.T) {
+	exp := strconv.FormatFloat(future, 'f', 0, 64)
+	cases := []struct {
+		name string
+		line string
+		want []CookieRecord
+	}{
+		{
+			"domain cookie",
+			".example.com\tTRUE\t/\tFALSE\t" + exp + "\tsid\tabc",
+			[]CookieRecord{{Name: "sid", Value: "abc", Domain: "example.com", Path: "/", Expires: future}},
+		},
+		{
+			"host only secure",
+			"www.example.com\tFALSE\t/app\tTRUE\t0\ttoken\tx=y",
+			[]CookieRecord{{Name: "token", Value: "x=y", Domain: "www.example.com", Path: "/app", Secure: true, HostOnly: true}},
+		},
+		{
+			"http only",
+			"#HttpOnly_.example.com\tTRUE\t/\tFALSE\t0\th\t1",
+			[]CookieRecord{{Name: "h", Value: "1", Domain: "example.com", Path: "/", HttpOnly: true}},
+		},
+		{
+			"empty value",
+			"example.com\tFALSE\t/\tFALSE\t0\tempty\t\r",
+			[]CookieRecord{{Name: "empty", Domain: "example.com", Path: "/", HostOnly: true}},
+		},
+		{"comment", "# Netscape HTTP Cookie File", nil},
+		{"blank", "  \t", nil},
+		{"too few fields", "example.com\tFALSE\t/\tFALSE\t0\tname", nil},
+	}
+	for _, c := range cases {
+		got, err := parseNetscape([]byte(c.line))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func cookieHeader(jar *Jar, rawurl string) string {
+	u, _ := url.Parse(rawurl)
+	var pairs []string
+	for _, c := range jar.Cookies(u) {
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+	return strings.Join(pairs, "; ")
+}
+
+func TestSeedCookies(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		name    string
+		content string
+		n       int
+		urls    map[string]string //[url]应发送的cookie
+	}{
+		{
+			name: "netscape",
+			content: "# Netscape HTTP Cookie File\n" +
+				".example.com\tTRUE\t/\tFALSE\t0\ta\t1\n" +
+				"www.example.com\tFALSE\t/\tTRUE\t0\tb\t2\n" +
+				"example.com\tTRUE\t/\tFALSE\t1\texpired\tx\n",
+			n: 3,
+			urls: map[string]string{
+				"http://sub.example.com/":  "a=1",
+				"https://www.example.com/": "a=1; b=2",
+				"http://www.example.com/":  "a=1",
+			},
+		},
+		{
+			name: "json",
+			content: `[
+				{"name":"a","value":"1","domain":".example.com","path":"/"},
+				{"name":"c","value":"3","domain":"example.com","path":"/only","hostOnly":true}
+			]`,
+			n: 2,
+			urls: map[string]string{
+				"http://sub.example.com/only": "a=1",
+				"http://example.com/only/x":   "c=3; a=1",
+			},
+		},
+	}
+	for _, c := range cases {
+		scope := "cookie_test_seed_" + c.name
+		fileName := filepath.Join(dir, c.name)
+		if err := ioutil.WriteFile(fileName, []byte(c.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		n, err := SeedCookies(scope, fileName)
+		if err != nil || n != c.n {
+			t.Errorf("%s: SeedCookies = %d, %v; want %d", c.name, n, err, c.n)
+		}
+		for u, want := range c.urls {
+			if got := cookieHeader(GetJar(scope), u); got != want {
+				t.Errorf("%s: jar sends %q to %s, want %q", c.name, got, u, want)
+			}
+			//新建的会话同样载入初始cookie
+			if got := cookieHeader(GetSession(scope+"/0").Jar(), u); got != want {
+				t.Errorf("%s: session sends %q to %s, want %q", c.name, got, u, want)
+			}
+		}
+		CloseJar(scope)
+	}
+}
+
+func TestJarRecords(t *testing.T) {
+	u, _ := url.Parse("http://www.example.com/app/page")
+	jar := NewJar()
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".Example.com", Path: "/"},
+		{Name: "age", Value: "3", MaxAge: 3600},
+		{Name: "gone", Value: "4", Expires: time.Now().Add(-time.Hour)},
+	})
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "host", Value: "5"},
+		{Name: "age", MaxAge: -1},
+	})
+	got := jar.Records()
+	want := []CookieRecord{
+		{Name: "domain", Value: "2", Domain: "example.com", Path: "/"},
+		{Name: "host", Value: "5", Domain: "www.example.com", Path: "/app", HostOnly: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Records() = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestSaveLoadCookies(t *testing.T) {
+	const scope = "cookie_test_save"
+	fileName := filepath.Join(t.TempDir(), "cookies", scope+".json")
+	jarRecords := []CookieRecord{
+		{Name: "a", Value: "1", Domain: "example.com", Path: "/", HttpOnly: true},
+		{Name: "b", Value: "2", Domain: "www.example.com", Path: "/x", Expires: future, Secure: true, HostOnly: true},
+	}
+	sessRecords := []CookieRecord{
+		{Name: "s", Value: "3", Domain: "example.com", Path: "/"},
+	}
+	GetJar(scope).Load(jarRecords)
+	GetJar(scope).Load([]CookieRecord{{Name: "old", Value: "x", Domain: "example.com", Path: "/", Expires: 1}})
+	GetSession(scope + "/1").Jar().Load(sessRecords)
+	GetSession(scope + "/2")                          //没有cookie的会话不保存
+	GetSession(scope + "x/0").Jar().Load(sessRecords) //其他隔离范围的会话不保存
+	defer CloseSessions(scope + "x/")
+
+	if err := SaveCookies(scope, fileName); err != nil {
+		t.Fatal(err)
+	}
+	CloseJar(scope)
+
+	if err := LoadCookies(scope, fileName); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseJar(scope)
+	if got := GetJar(scope).Records(); !reflect.DeepEqual(got, jarRecords) {
+		t.Errorf("jar after round trip = %+v\nwant %+v", got, jarRecords)
+	}
+	if got := GetSession(scope + "/1").Jar().Records(); !reflect.DeepEqual(got, sessRecords) {
+		t.Errorf("session after round trip = %+v\nwant %+v", got, sessRecords)
+	}
+	var saved cookieFile
+	b, _ := ioutil.ReadFile(fileName)
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Jar) != len(jarRecords) || len(saved.Sessions) != 1 || saved.Sessions["1"] == nil {
+		t.Errorf("saved file has unexpected sessions or cookies:\n%s", b)
+	}
+
+	//文件不存在时不报错
+	if err := LoadCookies("cookie_test_missing", fileName+".missing"); err != nil {
+		t.Errorf("LoadCookies on a missing file: %v", err)
+	}
+}
+
+func TestJarRefs(t *testing.T) {
+	const scope = "cookie_test_refs"
+	cases := []struct {
+		acquire bool
+		want    bool
+	}{
+		{true, true},
+		{true, false},
+		{false, false},
+		{false, true},
+		{true, true},
+	}
+	for i, c := range cases {
+		var got bool
+		if c.acquire {
+			got = AcquireJar(scope)
+		} else {
+			got = ReleaseJar(scope)
+		}
+		if got != c.want {
+			t.Errorf("step %d: got %v, want %v", i, got, c.want)
+		}
+	}
+	ReleaseJar(scope)
+}
+
+func TestDefaultPath(t *testing.T) {
+	cases := map[string]string{
+		"":        "/",
+		"x":       "/",
+		"/":       "/",
+		"/a":      "/",
+		"/a/":     "/a",
+		"/a/b/c":  "/a/b",
+		"/a/b/c/": "/a/b/c",
+	}
+	for in, want := range cases {
+		if got := defaultPath(in); got != want {
+			t.Errorf("defaultPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -2,11 +2,13 @@ package surfer
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"strings"
 	"time"
@@ -18,7 +20,9 @@ type Param struct {
 	method        string
 	url           *url.URL
 	proxy         *url.URL
-	body          io.Reader
+	session       *Session
+	cookieScope   string
+	body          []byte //请求体，每次重试时重新读取
 	header        http.Header
 	enableCookie  bool
 	dialTimeout   time.Duration
@@ -37,7 +41,7 @@ func NewParam(req Request) (param *Param, err error) {
 	}
 
 	if req.GetProxy() != "" {
-		if param.proxy, err = url.Parse(req.GetProxy()); err != nil {
+		if param.proxy, err = ParseProxy(req.GetProxy()); err != nil {
 			return nil, err
 		}
 	}
@@ -48,36 +52,44 @@ func NewParam(req Request) (param *Param, err error) {
 	}
 
 	switch method := strings.ToUpper(req.GetMethod()); method {
-	case "GET", "HEAD":
+	case "GET", "HEAD", "OPTIONS":
 		param.method = method
-	case "POST":
+		if len(req.GetBody()) > 0 {
+			param.setRawBody(req.GetBody())
+		}
+	case "POST", "PUT", "PATCH", "DELETE":
 		param.method = method
-		param.header.Add("Content-Type", "application/x-www-form-urlencoded")
-		param.body = strings.NewReader(req.GetPostData())
-	case "POST-M":
-		param.method = "POST"
-		body := &bytes.Buffer{}
-		writer := multipart.NewWriter(body)
-		values, _ := url.ParseQuery(req.GetPostData())
-		for k, vs := range values {
-			for _, v := range vs {
-				writer.WriteField(k, v)
+		switch {
+		case len(req.GetBody()) > 0:
+			param.setRawBody(req.GetBody())
+		case len(req.GetFiles()) > 0:
+			if err = param.setMultipartBody(req.GetPostData(), req.GetFiles()); err != nil {
+				return nil, err
 			}
+		case method == "POST" || req.GetPostData() != "":
+			param.setContentType("application/x-www-form-urlencoded")
+			param.body = []byte(req.GetPostData())
 		}
-		err := writer.Close()
-		if err != nil {
+	case "POST-M":
+		param.method = "POST"
+		if err = param.setMultipartBody(req.GetPostData(), req.GetFiles()); err != nil {
 			return nil, err
 		}
-		param.header.Add("Content-Type", writer.FormDataContentType())
-		param.body = body
 	default:
 		param.method = "GET"
 	}
 
 	param.enableCookie = req.GetEnableCookie()
+	param.cookieScope = req.GetCookieScope()
+
+	if id := req.GetSession(); id != "" {
+		param.session = GetSession(id)
+	}
 
 	if len(param.header.Get("User-Agent")) == 0 {
-		if param.enableCookie {
+		if param.session != nil {
+			param.header.Add("User-Agent", param.session.UserAgent())
+		} else if param.enableCookie {
 			param.header.Add("User-Agent", agent.UserAgents["common"][0])
 		} else {
 			l := len(agent.UserAgents["common"])
@@ -99,6 +111,75 @@ func NewParam(req Request) (param *Param, err error) {
 	return
 }
 
+//设置原始请求体，未指定Content-Type时根据内容推断
+func (self *Param) setRawBody(body []byte) {
+	self.body = body
+	if json.Valid(body) {
+		self.setContentType("application/json; charset=utf-8")
+	} else {
+		self.setContentType(http.DetectContentType(body))
+	}
+}
+
+//以multipart提交PostData中的字段与文件
+func (self *Param) setMultipartBody(postData string, files []FormFile) error {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	values, _ := url.ParseQuery(postData)
+	for k, vs := range values {
+		for _, v := range vs {
+			writer.WriteField(k, v)
+		}
+	}
+	for _, f := range files {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(f.Field), quoteEscaper.Replace(f.Name)))
+		contentType := f.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if _, err = part.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	//multipart的分隔符由本次生成，不能沿用调用方设置的Content-Type
+	self.header.Set("Content-Type", writer.FormDataContentType())
+	self.body = body.Bytes()
+	return nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+//调用方未设置Content-Type时使用默认值
+func (self *Param) setContentType(contentType string) {
+	if self.header.Get("Content-Type") == "" {
+		self.header.Set("Content-Type", contentType)
+	}
+}
+
+//生成本次尝试的http请求，请求体每次重新读取
+func (self *Param) newRequest() (*http.Request, error) {
+	var body io.Reader
+	if self.body != nil {
+		body = bytes.NewReader(self.body)
+	}
+	req, err := http.NewRequest(self.method, self.url.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = self.header
+	return req, nil
+}
+
 //回写request内容
 func (self *Param) writeback(resp *http.Response) *http.Response {
 	if resp == nil {
@@ -64,13 +64,18 @@ func (self *Phantom) Download(req Request) (resp *http.Response, err error) {
 	}
 	resp = param.writeback(resp)
 
+	postData := req.GetPostData()
+	if body := req.GetBody(); len(body) > 0 {
+		postData = string(body)
+	}
+
 	var args = []string{
 		self.jsFileMap["js"],
 		req.GetUrl(),
 		param.header.Get("Cookie"),
 		encoding,
 		param.header.Get("User-Agent"),
-		req.GetPostData(),
+		postData,
 		strings.ToLower(param.method),
 	}
 
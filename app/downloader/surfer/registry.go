@@ -0,0 +1,117 @@
+package surfer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//已注册的下载器内核，首次使用时才会被创建
+type kernel struct {
+	id      int
+	name    string
+	newFunc func() Surfer
+	surfer  Surfer
+	lock    sync.Mutex
+}
+
+func (self *kernel) get() Surfer {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.surfer == nil {
+		self.surfer = self.newFunc()
+	}
+	return self.surfer
+}
+
+//已创建的下载器，尚未创建时返回nil
+func (self *kernel) created() Surfer {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.surfer
+}
+
+var kernels = struct {
+	byID   map[int]*kernel
+	byName map[string]*kernel
+	sync.RWMutex
+}{
+	byID:   make(map[int]*kernel),
+	byName: make(map[string]*kernel),
+}
+
+func init() {
+	Register(SurfID, "surf", New)
+	Register(PhomtomJsID, "phantom", func() Surfer {
+		return NewPhantom(phantomjsFile, tempJsDir)
+	})
+}
+
+/**
+  注册下载器内核
+  同一ID重复注册时，新内核覆盖旧内核，可用于替换默认的surf、phantom实现；
+  名称已被其他ID占用时返回错误。
+*/
+func Register(id int, name string, newFunc func() Surfer) error {
+	if newFunc == nil {
+		return fmt.Errorf("下载器 [%d]%s 的构造函数不能为nil", id, name)
+	}
+	kernels.Lock()
+	defer kernels.Unlock()
+	if k, ok := kernels.byName[name]; ok && k.id != id {
+		return fmt.Errorf("下载器名称 %s 已被ID %d 占用", name, k.id)
+	}
+	if old, ok := kernels.byID[id]; ok {
+		delete(kernels.byName, old.name)
+	}
+	k := &kernel{
+		id:      id,
+		name:    name,
+		newFunc: newFunc,
+	}
+	kernels.byID[id] = k
+	kernels.byName[name] = k
+	return nil
+}
+
+//按ID获取下载器内核
+func Get(id int) (Surfer, bool) {
+	kernels.RLock()
+	k, ok := kernels.byID[id]
+	kernels.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return k.get(), true
+}
+
+//判断ID是否已注册
+func IsRegistered(id int) bool {
+	kernels.RLock()
+	_, ok := kernels.byID[id]
+	kernels.RUnlock()
+	return ok
+}
+
+//按名称查找下载器ID
+func DownloaderID(name string) (int, bool) {
+	kernels.RLock()
+	k, ok := kernels.byName[name]
+	kernels.RUnlock()
+	if !ok {
+		return 0, false
+	}
+	return k.id, true
+}
+
+//全部已注册的下载器名称
+func Downloaders() []string {
+	kernels.RLock()
+	names := make([]string, 0, len(kernels.byName))
+	for name := range kernels.byName {
+		names = append(names, name)
+	}
+	kernels.RUnlock()
+	sort.Strings(names)
+	return names
+}
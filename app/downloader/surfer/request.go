@@ -12,6 +12,8 @@ type (
 		GetUrl() string
 		GetMethod() string
 		GetPostData() string
+		GetBody() []byte      //原始请求体，设置后优先于PostData
+		GetFiles() []FormFile //multipart表单中的文件
 		GetHeader() http.Header
 		GetEnableCookie() bool
 		GetDialTimeout() time.Duration
@@ -21,6 +23,8 @@ type (
 		GetProxy() string
 		GetRedirectTimes() int
 		GetDownloaderID() int
+		GetSession() string     //会话ID，为空时不使用会话
+		GetCookieScope() string //cookie的隔离范围，为空时与其他请求共用cookie
 	}
 
 	//默认实现的Request
@@ -30,21 +34,34 @@ type (
 		Header        http.Header
 		EnableCookie  bool
 		PostData      string
+		Body          []byte     //原始请求体，设置后优先于PostData，Content-Type以Header中的为准
+		Files         []FormFile //multipart表单中的文件，设置后以multipart提交
 		DialTimeout   time.Duration
 		ConnTimeout   time.Duration
 		TryTimes      int
 		RetryPause    time.Duration
 		RedirectTimes int
 		Proxy         string
+		Session       string //会话ID，同一会话的请求共用cookie、User-Agent与代理
+		CookieScope   string //cookie的隔离范围，相同范围的请求共用cookie
 
-		// 指定下载器ID
+		// 指定下载器ID，未注册的ID将回退为Surf
 		// 0为Surf高并发下载器，各种控制功能齐全
 		// 1为PhantomJS下载器，特点破防力强，速度慢，低并发
+		// 其他ID需先通过Register注册
 		DownloaderID int
 
 		//保证prepare只调用一次
 		once sync.Once
 	}
+
+	//multipart表单中的文件
+	FormFile struct {
+		Field       string //表单字段名
+		Name        string //文件名
+		ContentType string //为空时为application/octet-stream
+		Data        []byte
+	}
 )
 
 const (
@@ -87,7 +104,7 @@ func (self *DefaultRequest) prepare() {
 		self.RetryPause = DefaultRetryPause
 	}
 
-	if self.DownloaderID != PhomtomJsID {
+	if !IsRegistered(self.DownloaderID) {
 		self.DownloaderID = SurfID
 	}
 }
@@ -98,7 +115,7 @@ func (self *DefaultRequest) GetUrl() string {
 	return self.Url
 }
 
-// GET POST POST-M HEAD
+// GET POST POST-M HEAD PUT PATCH DELETE OPTIONS
 func (self *DefaultRequest) GetMethod() string {
 	self.once.Do(self.prepare)
 	return self.Method
@@ -110,6 +127,18 @@ func (self *DefaultRequest) GetPostData() string {
 	return self.PostData
 }
 
+// raw body
+func (self *DefaultRequest) GetBody() []byte {
+	self.once.Do(self.prepare)
+	return self.Body
+}
+
+// multipart files
+func (self *DefaultRequest) GetFiles() []FormFile {
+	self.once.Do(self.prepare)
+	return self.Files
+}
+
 // http header
 func (self *DefaultRequest) GetHeader() http.Header {
 	self.once.Do(self.prepare)
@@ -163,3 +192,15 @@ func (self *DefaultRequest) GetDownloaderID() int {
 	self.once.Do(self.prepare)
 	return self.DownloaderID
 }
+
+// the session id
+func (self *DefaultRequest) GetSession() string {
+	self.once.Do(self.prepare)
+	return self.Session
+}
+
+// the cookie jar scope
+func (self *DefaultRequest) GetCookieScope() string {
+	self.once.Do(self.prepare)
+	return self.CookieScope
+}
@@ -0,0 +1,103 @@
+package surfer
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/l-dandelion/gospider/app/downloader/surfer/agent"
+)
+
+/**
+  会话，将cookie、User-Agent与代理绑定在一起
+  同一会话的请求共用cookie与User-Agent，并由调度器分配相同的代理，
+  以免登录状态在不同IP或浏览器标识之间切换
+*/
+type Session struct {
+	Id        string
+	jar       *Jar
+	userAgent string
+	proxy     string
+	sync.RWMutex
+}
+
+var sessions = struct {
+	m map[string]*Session
+	sync.Mutex
+}{
+	m: make(map[string]*Session),
+}
+
+/**
+  获取会话，不存在时创建
+  会话ID形如 隔离范围/名称，新建的会话载入该隔离范围的初始cookie
+*/
+func GetSession(id string) *Session {
+	sessions.Lock()
+	defer sessions.Unlock()
+	sess := sessions.m[id]
+	if sess == nil {
+		sess = &Session{Id: id}
+		sess.reset()
+		if i := strings.LastIndex(id, "/"); i >= 0 {
+			jars.Lock()
+			seeds := jars.seeds[id[:i]]
+			jars.Unlock()
+			sess.jar.Load(seeds)
+		}
+		sessions.m[id] = sess
+	}
+	return sess
+}
+
+//移除ID以prefix开头的全部会话
+func CloseSessions(prefix string) {
+	sessions.Lock()
+	defer sessions.Unlock()
+	for id := range sessions.m {
+		if strings.HasPrefix(id, prefix) {
+			delete(sessions.m, id)
+		}
+	}
+}
+
+func (self *Session) Jar() *Jar {
+	self.RLock()
+	defer self.RUnlock()
+	return self.jar
+}
+
+func (self *Session) UserAgent() string {
+	self.RLock()
+	defer self.RUnlock()
+	return self.userAgent
+}
+
+//会话绑定的代理，为空时尚未绑定
+func (self *Session) Proxy() string {
+	self.RLock()
+	defer self.RUnlock()
+	return self.proxy
+}
+
+func (self *Session) BindProxy(proxy string) {
+	self.Lock()
+	self.proxy = proxy
+	self.Unlock()
+}
+
+//丢弃cookie与代理，并更换User-Agent，相当于开始新的会话
+func (self *Session) Reset() {
+	self.Lock()
+	self.reset()
+	self.Unlock()
+}
+
+func (self *Session) reset() {
+	self.jar = NewJar()
+	l := len(agent.UserAgents["common"])
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	self.userAgent = agent.UserAgents["common"][r.Intn(l)]
+	self.proxy = ""
+}
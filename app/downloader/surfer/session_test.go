@@ -0,0 +1,38 @@
+package surfer
+
+import "testing"
+
+func TestSession(t *testing.T) {
+	a := GetSession("session_test/0")
+	if a != GetSession("session_test/0") {
+		t.Fatal("the same id should return the same session")
+	}
+	if a == GetSession("session_test/1") {
+		t.Fatal("different ids should return different sessions")
+	}
+	if a.UserAgent() == "" || a.Jar() == nil || a.Proxy() != "" {
+		t.Fatalf("new session: agent %q, jar %v, proxy %q", a.UserAgent(), a.Jar(), a.Proxy())
+	}
+
+	a.BindProxy("http://1.2.3.4:8080")
+	if a.Proxy() != "http://1.2.3.4:8080" {
+		t.Errorf("Proxy() = %q after BindProxy", a.Proxy())
+	}
+	jar := a.Jar()
+	a.Reset()
+	if a.Proxy() != "" || a.Jar() == jar || a.UserAgent() == "" {
+		t.Errorf("Reset kept proxy %q or the old jar", a.Proxy())
+	}
+
+	GetSession("session_test2/0")
+	CloseSessions("session_test/")
+	if GetSession("session_test/0") == a {
+		t.Error("closed session was reused")
+	}
+	sessions.Lock()
+	_, kept := sessions.m["session_test2/0"]
+	sessions.Unlock()
+	if !kept {
+		t.Error("CloseSessions removed a session outside the prefix")
+	}
+}
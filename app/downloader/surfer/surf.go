@@ -9,20 +9,20 @@ import (
 	"math/rand"
 	"net"
 	"net/http"
-	"net/http/cookiejar"
 	"strings"
 	"time"
 
+	"github.com/l-dandelion/gospider/app/aid/metrics"
 	"github.com/l-dandelion/gospider/app/downloader/surfer/agent"
 )
 
 type Surf struct {
-	cookieJar *cookiejar.Jar
+	cookieJar *Jar //未指定cookie隔离范围的请求共用
 }
 
 func New() Surfer {
 	s := new(Surf)
-	s.cookieJar, _ = cookiejar.New(nil)
+	s.cookieJar = NewJar()
 	return s
 }
 
@@ -65,13 +65,23 @@ func (self *Surf) BuildClient(param *Param) *http.Client {
 		CheckRedirect: param.checkRedirect,
 	}
 
-	if param.enableCookie {
-		client.Jar = self.cookieJar
+	if param.session != nil {
+		client.Jar = param.session.Jar()
+	} else if param.enableCookie {
+		if param.cookieScope != "" {
+			client.Jar = GetJar(param.cookieScope)
+		} else {
+			client.Jar = self.cookieJar
+		}
+	}
+
+	dial := func(network, addr string) (net.Conn, error) {
+		return net.DialTimeout(network, addr, param.dialTimeout)
 	}
 
 	transport := &http.Transport{
 		Dial: func(network, addr string) (net.Conn, error) {
-			c, err := net.DialTimeout(network, addr, param.dialTimeout)
+			c, err := dial(network, addr)
 			if err != nil {
 				return nil, err
 			}
@@ -83,7 +93,19 @@ func (self *Surf) BuildClient(param *Param) *http.Client {
 	}
 
 	if param.proxy != nil {
-		transport.Proxy = http.ProxyURL(param.proxy)
+		switch param.proxy.Scheme {
+		case "socks5", "socks5h":
+			//经socks5代理建立连接，账号密码取自代理地址
+			dialer, err := socks5Dialer(param.proxy, param.dialTimeout)
+			if err != nil {
+				dial = func(string, string) (net.Conn, error) { return nil, err }
+			} else {
+				dial = dialer.Dial
+			}
+		default:
+			//http与https代理，地址中的账号密码以Proxy-Authorization发送
+			transport.Proxy = http.ProxyURL(param.proxy)
+		}
 	}
 
 	if strings.ToLower(param.url.Scheme) == "https" {
@@ -95,16 +117,16 @@ func (self *Surf) BuildClient(param *Param) *http.Client {
 }
 
 func (self *Surf) httpRequest(param *Param) (resp *http.Response, err error) {
-	req, err := http.NewRequest(param.method, param.url.String(), param.body)
-	if err != nil {
-		return nil, err
-	}
-	req.Header = param.header
+	var req *http.Request
 	if param.tryTimes <= 0 {
 		for {
+			if req, err = param.newRequest(); err != nil {
+				return nil, err
+			}
 			resp, err = param.client.Do(req)
 			if err != nil {
-				if !param.enableCookie {
+				metrics.IncRetry(param.url.Host)
+				if !param.enableCookie && param.session == nil {
 					l := len(agent.UserAgents["common"])
 					r := rand.New(rand.NewSource(time.Now().UnixNano()))
 					req.Header.Set("User-Agent", agent.UserAgents["common"][r.Intn(l)])
@@ -116,9 +138,15 @@ func (self *Surf) httpRequest(param *Param) (resp *http.Response, err error) {
 		}
 	} else {
 		for i := 0; i < param.tryTimes; i++ {
+			if req, err = param.newRequest(); err != nil {
+				return nil, err
+			}
 			resp, err = param.client.Do(req)
 			if err != nil {
-				if !param.enableCookie {
+				if i+1 < param.tryTimes {
+					metrics.IncRetry(param.url.Host)
+				}
+				if !param.enableCookie && param.session == nil {
 					l := len(agent.UserAgents["common"])
 					r := rand.New(rand.NewSource(time.Now().UnixNano()))
 					req.Header.Set("User-Agent", agent.UserAgents["common"][r.Intn(l)])
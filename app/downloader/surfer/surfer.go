@@ -1,8 +1,8 @@
 package surfer
 
 import (
+	"fmt"
 	"net/http"
-	"sync"
 )
 
 type Surfer interface {
@@ -10,32 +10,30 @@ type Surfer interface {
 }
 
 var (
-	surf          Surfer
-	phantom       Surfer
-	once_surf     sync.Once
-	once_phantom  sync.Once
 	tempJsDir     = "./tmp"
 	phantomjsFile = `./phantomjs`
 )
 
+//设置phantomjs程序与临时js文件目录，须在首次使用phantom下载器前调用
+func SetPhantomPath(file, tempDir string) {
+	phantomjsFile = file
+	tempJsDir = tempDir
+}
+
 func Download(req Request) (resp *http.Response, err error) {
-	switch req.GetDownloaderID() {
-	case SurfID:
-		once_surf.Do(func() {
-			surf = New()
-		})
-		resp, err = surf.Download(req)
-	case PhomtomJsID:
-		once_phantom.Do(func() {
-			phantom = NewPhantom(phantomjsFile, tempJsDir)
-		})
-		resp, err = phantom.Download(req)
+	s, ok := Get(req.GetDownloaderID())
+	if !ok {
+		return nil, fmt.Errorf("下载器ID %d 未注册", req.GetDownloaderID())
 	}
-	return
+	return s.Download(req)
 }
 
 func DestroyJsFiles() {
-	if pt, ok := phantom.(*Phantom); ok {
-		pt.DestroyJsFiles()
+	kernels.RLock()
+	defer kernels.RUnlock()
+	for _, k := range kernels.byID {
+		if pt, ok := k.created().(*Phantom); ok {
+			pt.DestroyJsFiles()
+		}
 	}
 }
@@ -1,12 +1,16 @@
 package collector
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/henrylee2cn/pholcus/logs"
 	"github.com/henrylee2cn/pholcus/runtime/cache"
+	"github.com/l-dandelion/gospider/app/aid/dedup"
+	"github.com/l-dandelion/gospider/app/aid/metrics"
 	"github.com/l-dandelion/gospider/app/pipeline/collector/data"
 	"github.com/l-dandelion/gospider/app/spider"
 )
@@ -20,11 +24,19 @@ type Collector struct {
 	dataBatch   uint64
 	fileBatch   uint64
 	wait        sync.WaitGroup
-	sum         [4]uint64 //收集的数据总数[上次输出后文本总数，本次输出后文本总数，上次输出后文件总数，本次输出后文件总数]，非并发安全
+	sum         [4]uint64              //收集的数据总数[上次输出后文本总数，本次输出后文本总数，上次输出后文件总数，本次输出后文件总数]，非并发安全
+	items       map[string]*itemFilter //[规则名]结果数据去重
+	dropped     uint64                 //因内容重复而丢弃的数据数
 	dataSumLock sync.RWMutex
 	fileSumLock sync.RWMutex
 }
 
+//同一规则的结果数据去重
+type itemFilter struct {
+	*dedup.Filter
+	fields []string //参与比较的字段，为空时比较全部字段
+}
+
 func NewCollector(sp *spider.Spider) *Collector {
 	var self = &Collector{}
 	self.Spider = sp
@@ -36,6 +48,15 @@ func NewCollector(sp *spider.Spider) *Collector {
 	self.FileChan = make(chan data.FileCell, cache.Task.DockerCap)
 	self.dataDocker = make([]data.DataCell, 0, cache.Task.DockerCap)
 	self.sum = [4]uint64{}
+	self.items = make(map[string]*itemFilter)
+	for name, rule := range sp.RuleTree.Trunk {
+		if rule.ItemDedup != nil {
+			self.items[name] = &itemFilter{
+				Filter: dedup.New(rule.ItemDedup),
+				fields: rule.ItemDedup.Fields,
+			}
+		}
+	}
 
 	self.dataBatch = 0
 	self.fileBatch = 0
@@ -75,7 +96,7 @@ func (self *Collector) Stop() {
 		defer func() {
 			recover()
 		}()
-		close(self.DataChan)
+		close(self.FileChan)
 	}()
 }
 
@@ -89,6 +110,9 @@ func (self *Collector) Start() {
 				recover()
 			}()
 			for data := range self.DataChan {
+				if self.duplicate(data) {
+					continue
+				}
 				self.dataDocker = append(self.dataDocker, data)
 				if len(self.dataDocker) < cache.Task.DockerCap {
 					continue
@@ -123,6 +147,33 @@ func (self *Collector) Start() {
 	}()
 }
 
+//结果数据是否与本次已收集的数据重复，重复的数据被丢弃
+func (self *Collector) duplicate(cell data.DataCell) bool {
+	ruleName, _ := cell["RuleName"].(string)
+	filter := self.items[ruleName]
+	if filter == nil {
+		return false
+	}
+	vd, _ := cell["Data"].(map[string]interface{})
+	if len(filter.fields) > 0 {
+		selected := make(map[string]interface{}, len(filter.fields))
+		for _, field := range filter.fields {
+			selected[field] = vd[field]
+		}
+		vd = selected
+	}
+	//map按键排序编码，字段顺序不影响比较
+	b, _ := json.Marshal(vd)
+	if !filter.Seen(b) {
+		return false
+	}
+	data.PutDataCell(cell)
+	self.dropped++
+	dedup.AddDroppedItem()
+	metrics.IncDuplicate(self.Spider.GetName(), "item")
+	return true
+}
+
 func (self *Collector) resetDataDocker() {
 	for _, cell := range self.dataDocker {
 		data.PutDataCell(cell)
@@ -156,7 +207,20 @@ func (self *Collector) addFileSum(add uint64) {
 	self.sum[3] += add
 }
 
+//已输出的文本数据总数
+func (self *Collector) DataNum() uint64 {
+	return self.dataSum()
+}
+
+//已输出的文件总数
+func (self *Collector) FileNum() uint64 {
+	return self.fileSum()
+}
+
 func (self *Collector) Report() {
+	if self.dropped > 0 {
+		logs.Log.App(" *     [去重：%s | KEYIN：%s]   丢弃重复数据 %v 条\n", self.Spider.GetName(), self.GetKeyin(), self.dropped)
+	}
 	cache.ReportChan <- &cache.Report{
 		SpiderName: self.Spider.GetName(),
 		Keyin:      self.GetKeyin(),
@@ -50,6 +50,7 @@ func PutDataCell(cell DataCell) {
 	cell["Url"] = nil
 	cell["ParentUrl"] = nil
 	cell["DownloadTime"] = nil
+	cell["FieldTypes"] = nil
 	dataCellPool.Put(cell)
 }
 
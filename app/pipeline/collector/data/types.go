@@ -0,0 +1,50 @@
+package data
+
+import (
+	"reflect"
+	"time"
+)
+
+//字段类型，由结构体结果推断，供输出时建立对应类型的列
+type FieldType string
+
+const (
+	TYPE_STRING FieldType = "string"
+	TYPE_INT    FieldType = "int"
+	TYPE_FLOAT  FieldType = "float"
+	TYPE_BOOL   FieldType = "bool"
+	TYPE_TIME   FieldType = "time"
+	TYPE_JSON   FieldType = "json" //切片、映射、结构体及指针等，以JSON文本输出
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func TypeOf(t reflect.Type) FieldType {
+	if t == timeType {
+		return TYPE_TIME
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return TYPE_STRING
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return TYPE_INT
+	case reflect.Float32, reflect.Float64:
+		return TYPE_FLOAT
+	case reflect.Bool:
+		return TYPE_BOOL
+	}
+	return TYPE_JSON
+}
+
+//获取结果数据的字段类型，非结构体结果返回nil
+func (self DataCell) FieldTypes() map[string]FieldType {
+	types, _ := self["FieldTypes"].(map[string]FieldType)
+	return types
+}
+
+//记录结果数据的字段类型
+func (self DataCell) SetFieldTypes(types map[string]FieldType) DataCell {
+	self["FieldTypes"] = types
+	return self
+}
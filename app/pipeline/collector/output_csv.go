@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/henrylee2cn/pholcus/common/util"
+)
+
+/************************ CSV 输出 ***************************/
+//每个namespace__subNamespace追加写入同一文件，新建文件时写入BOM与表头
+func init() {
+	DataOutput["csv"] = func(self *Collector) (err error) {
+		var (
+			namespace = util.FileNameReplace(self.namespace())
+			writers   = make(map[string]*csv.Writer)
+			files     = make(map[string]*os.File)
+		)
+		//写入错误在Flush时才会暴露，返回首个错误
+		defer func() {
+			for name, w := range writers {
+				w.Flush()
+				if e := w.Error(); e != nil && err == nil {
+					err = fmt.Errorf("写入文件失败: %v", e)
+				}
+				if e := files[name].Close(); e != nil && err == nil {
+					err = fmt.Errorf("关闭文件失败: %v", e)
+				}
+			}
+		}()
+
+		for _, datacell := range self.dataDocker {
+			subNamespace := util.FileNameReplace(self.subNamespace(datacell))
+			titles, values := self.row(datacell)
+			w, ok := writers[subNamespace]
+			if !ok {
+				dir := textDir(namespace, subNamespace)
+				if err := os.MkdirAll(dir, 0777); err != nil {
+					return fmt.Errorf("创建目录失败: %v", err)
+				}
+				fileName := filepath.Join(dir, "data.csv")
+				f, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0777)
+				if err != nil {
+					return fmt.Errorf("打开文件失败: %v", err)
+				}
+				info, err := f.Stat()
+				if err != nil {
+					f.Close()
+					return fmt.Errorf("打开文件失败: %v", err)
+				}
+				w = csv.NewWriter(f)
+				if info.Size() == 0 {
+					//写入UTF-8 BOM，便于Excel识别编码
+					f.WriteString("\xEF\xBB\xBF")
+					w.Write(titles)
+				}
+				writers[subNamespace] = w
+				files[subNamespace] = f
+			}
+			w.Write(values)
+		}
+		return nil
+	}
+}
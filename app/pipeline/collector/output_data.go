@@ -1,7 +1,10 @@
 package collector
 
 import (
+	"fmt"
+
 	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/l-dandelion/gospider/app/aid/metrics"
 )
 
 var (
@@ -23,6 +26,7 @@ func (self *Collector) outputData() {
 
 	defer func() {
 		if p := recover(); p != nil {
+			metrics.ObserveOutput(self.Spider.GetName(), self.outType, int(dataLen), fmt.Errorf("%v", p))
 			logs.Log.Informational(" * ")
 			logs.Log.App(" *     Panic [数据输出:%v | KEYIN: %v | 批次: %v] 数据 %v 条！ [ERROR] %v\n", self.Spider.GetName(), self.Spider.GetKeyin(), self.dataBatch, dataLen, p)
 		}
@@ -30,7 +34,13 @@ func (self *Collector) outputData() {
 
 	self.addDataSum(dataLen)
 
-	err := DataOutput[self.outType](self)
+	var err error
+	if output, ok := DataOutput[self.outType]; ok {
+		err = output(self)
+	} else {
+		err = fmt.Errorf("不支持的输出方式: %s", self.outType)
+	}
+	metrics.ObserveOutput(self.Spider.GetName(), self.outType, int(dataLen), err)
 
 	logs.Log.Informational(" * ")
 	if err != nil {
@@ -40,6 +50,7 @@ func (self *Collector) outputData() {
 		logs.Log.App(" *     [数据输出：%v | KEYIN：%v | 批次：%v]   数据 %v 条！\n",
 			self.Spider.GetName(), self.Spider.GetKeyin(), self.dataBatch, dataLen)
 		self.Spider.TryFlushSuccess()
+		self.Spider.TryFlushFailure()
 	}
 }
 
@@ -0,0 +1,285 @@
+package collector
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/l-dandelion/gospider/app/pipeline/collector/data"
+)
+
+/************************ Excel 输出 ***************************/
+//每批数据每个namespace生成一个xlsx文件，每个subNamespace为一个工作表，超出行数上限时续写至新工作表
+func init() {
+	DataOutput["excel"] = func(self *Collector) error {
+		var (
+			namespace = util.FileNameReplace(self.namespace())
+			book      = &xlsxBook{}
+			sheets    = make(map[string]*xlsxSheet)
+		)
+		for _, datacell := range self.dataDocker {
+			subNamespace := util.FileNameReplace(self.subNamespace(datacell))
+			titles, values, types := self.fields(datacell)
+			sheet, ok := sheets[subNamespace]
+			if !ok || len(sheet.rows) >= xlsxMaxRows {
+				sheet = book.addSheet(subNamespace)
+				header := make([]xlsxCell, len(titles))
+				for i, title := range titles {
+					header[i] = newXlsxCell(title, data.TYPE_STRING)
+				}
+				sheet.rows = append(sheet.rows, header)
+				sheets[subNamespace] = sheet
+			}
+			row := make([]xlsxCell, len(values))
+			for i, v := range values {
+				row[i] = newXlsxCell(v, types[i])
+			}
+			sheet.rows = append(sheet.rows, row)
+		}
+
+		dir := textDir(namespace, "")
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+		fileName := filepath.Join(dir, fmt.Sprintf("%v-%v.xlsx", self.sum[0], self.sum[1]))
+		f, err := os.Create(fileName)
+		if err != nil {
+			return fmt.Errorf("创建文件失败: %v", err)
+		}
+		if err = book.write(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
+
+type (
+	//最简xlsx，单元格为数值、布尔、日期时间或内联字符串
+	xlsxBook struct {
+		sheets []*xlsxSheet
+	}
+	xlsxSheet struct {
+		name string
+		rows [][]xlsxCell
+	}
+	xlsxCell struct {
+		kind  byte   //单元格类型
+		value string //数值与布尔为字面值，日期时间为Excel序列值
+	}
+)
+
+const (
+	xlsxString = iota
+	xlsxNumber
+	xlsxBool
+	xlsxTime
+
+	//Excel单元格的最大字符数（按UTF-16计）
+	xlsxMaxChars = 32767
+	//Excel数值的有效位数，更长的整数以文本保存以免丢失精度
+	xlsxMaxDigits = 15
+)
+
+var (
+	xlsxMaxRows = 1048576                                       //Excel工作表的最大行数
+	xlsxEpoch   = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC) //Excel日期序列值的起点
+)
+
+//按字段类型生成单元格，数值、布尔与时间保留其类型，其余转为文本
+func newXlsxCell(v interface{}, t data.FieldType) xlsxCell {
+	switch v2 := v.(type) {
+	case bool:
+		if v2 {
+			return xlsxCell{xlsxBool, "1"}
+		}
+		return xlsxCell{xlsxBool, "0"}
+	case time.Time:
+		return xlsxTimeCell(v2)
+	case string:
+		if t == data.TYPE_TIME {
+			if tm, err := time.Parse(time.RFC3339Nano, v2); err == nil {
+				return xlsxTimeCell(tm)
+			}
+		}
+	case float64:
+		if !math.IsInf(v2, 0) && !math.IsNaN(v2) {
+			return xlsxNumberCell(strconv.FormatFloat(v2, 'g', -1, 64))
+		}
+	case float32:
+		if f := float64(v2); !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return xlsxNumberCell(strconv.FormatFloat(f, 'g', -1, 32))
+		}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return xlsxNumberCell(fmt.Sprint(v2))
+	}
+	return xlsxCell{xlsxString, truncateUTF16(formatValue(v, t), xlsxMaxChars)}
+}
+
+func xlsxNumberCell(s string) xlsxCell {
+	digits := strings.TrimLeft(s, "-")
+	if !strings.ContainsAny(digits, ".eE") && len(digits) > xlsxMaxDigits {
+		return xlsxCell{xlsxString, s}
+	}
+	return xlsxCell{xlsxNumber, s}
+}
+
+//日期时间按其本地时刻换算为Excel序列值
+func xlsxTimeCell(t time.Time) xlsxCell {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	days := float64(wall.Sub(xlsxEpoch)) / float64(24*time.Hour)
+	return xlsxCell{xlsxTime, strconv.FormatFloat(days, 'f', -1, 64)}
+}
+
+//截断为至多max个UTF-16码元，不拆分代理对
+func truncateUTF16(s string, max int) string {
+	n := 0
+	for i, r := range s {
+		w := 1
+		if r >= 0x10000 {
+			w = 2
+		}
+		if n+w > max {
+			return s[:i]
+		}
+		n += w
+	}
+	return s
+}
+
+func (self *xlsxBook) addSheet(name string) *xlsxSheet {
+	name = strings.NewReplacer(":", "_", "\\", "_", "/", "_", "?", "_", "*", "_", "[", "_", "]", "_").Replace(name)
+	if name == "" {
+		name = "Sheet"
+	}
+	if r := []rune(name); len(r) > 28 {
+		name = string(r[:28])
+	}
+	base := name
+	for i := 2; self.hasSheet(name); i++ {
+		name = base + "(" + strconv.Itoa(i) + ")"
+	}
+	sheet := &xlsxSheet{name: name}
+	self.sheets = append(self.sheets, sheet)
+	return sheet
+}
+
+func (self *xlsxBook) hasSheet(name string) bool {
+	for _, s := range self.sheets {
+		if strings.EqualFold(s.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *xlsxBook) write(w io.Writer) error {
+	z := zip.NewWriter(w)
+
+	var types, sheets, rels strings.Builder
+	for i, sheet := range self.sheets {
+		n := strconv.Itoa(i + 1)
+		types.WriteString(`<Override PartName="/xl/worksheets/sheet` + n + `.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`)
+		sheets.WriteString(`<sheet name="` + xmlEscape(sheet.name) + `" sheetId="` + n + `" r:id="rId` + n + `"/>`)
+		rels.WriteString(`<Relationship Id="rId` + n + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet` + n + `.xml"/>`)
+	}
+
+	files := []struct{ name, body string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() +
+			`<Relationship Id="rIdStyles" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+			`</Relationships>`},
+		//样式1为内置的日期时间格式（yyyy/m/d h:mm）
+		{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+			`<xf numFmtId="22" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+	for _, file := range files {
+		fw, err := z.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(fw, file.body); err != nil {
+			return err
+		}
+	}
+
+	for i, sheet := range self.sheets {
+		fw, err := z.Create("xl/worksheets/sheet" + strconv.Itoa(i+1) + ".xml")
+		if err != nil {
+			return err
+		}
+		if err = sheet.write(fw); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+func (self *xlsxSheet) write(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range self.rows {
+		rn := strconv.Itoa(r + 1)
+		b.WriteString(`<row r="` + rn + `">`)
+		for c, cell := range row {
+			ref := xlsxColumn(c) + rn
+			switch cell.kind {
+			case xlsxNumber:
+				b.WriteString(`<c r="` + ref + `"><v>` + cell.value + `</v></c>`)
+			case xlsxBool:
+				b.WriteString(`<c r="` + ref + `" t="b"><v>` + cell.value + `</v></c>`)
+			case xlsxTime:
+				b.WriteString(`<c r="` + ref + `" s="1"><v>` + cell.value + `</v></c>`)
+			default:
+				b.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+				b.WriteString(xmlEscape(cell.value))
+				b.WriteString(`</t></is></c>`)
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+//列序号转为Excel列名，0为A
+func xlsxColumn(i int) string {
+	var s []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		s = append([]byte{byte('A' + (i-1)%26)}, s...)
+	}
+	return string(s)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
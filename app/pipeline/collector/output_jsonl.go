@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/henrylee2cn/pholcus/common/util"
+)
+
+/************************ JSON Lines 输出 ***************************/
+func init() {
+	DataOutput["jsonl"] = func(self *Collector) (err error) {
+		var (
+			namespace = util.FileNameReplace(self.namespace())
+			writers   = make(map[string]*bufio.Writer)
+			files     = make(map[string]*os.File)
+		)
+		//写入错误在Flush时才会暴露，返回首个错误
+		defer func() {
+			for name, w := range writers {
+				if e := w.Flush(); e != nil && err == nil {
+					err = fmt.Errorf("写入文件失败: %v", e)
+				}
+				if e := files[name].Close(); e != nil && err == nil {
+					err = fmt.Errorf("关闭文件失败: %v", e)
+				}
+			}
+		}()
+
+		for _, datacell := range self.dataDocker {
+			subNamespace := util.FileNameReplace(self.subNamespace(datacell))
+			w, ok := writers[subNamespace]
+			if !ok {
+				dir := textDir(namespace, subNamespace)
+				if err := os.MkdirAll(dir, 0777); err != nil {
+					return fmt.Errorf("创建目录失败: %v", err)
+				}
+				fileName := filepath.Join(dir, "data.jsonl")
+				f, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0777)
+				if err != nil {
+					return fmt.Errorf("打开文件失败: %v", err)
+				}
+				w = bufio.NewWriter(f)
+				writers[subNamespace] = w
+				files[subNamespace] = f
+			}
+
+			obj := make(map[string]interface{})
+			if vd, ok := datacell["Data"].(map[string]interface{}); ok {
+				for k, v := range vd {
+					obj[k] = v
+				}
+			}
+			if self.Spider.OutDefaultField() {
+				obj["Url"] = datacell["Url"]
+				obj["ParentUrl"] = datacell["ParentUrl"]
+				obj["DownloadTime"] = datacell["DownloadTime"]
+			}
+			b, err := json.Marshal(obj)
+			if err != nil {
+				return err
+			}
+			w.Write(b)
+			w.WriteByte('\n')
+		}
+		return nil
+	}
+}
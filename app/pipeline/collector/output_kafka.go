@@ -0,0 +1,67 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/Shopify/sarama"
+	"github.com/henrylee2cn/pholcus/common/kafka"
+	"github.com/henrylee2cn/pholcus/common/util"
+)
+
+//作为kafka消息key的字段名，为空时不指定key，由kafka随机分区
+var kafkaKeyField string
+
+//设置kafka消息的分区key字段，可为规则字段名或Url、ParentUrl、DownloadTime
+func SetKafkaKeyField(field string) {
+	kafkaKeyField = field
+}
+
+/************************ Kafka 输出 ***************************/
+func init() {
+	var topic = regexp.MustCompile("^[0-9a-zA-Z_-]+$")
+
+	DataOutput["kafka"] = func(self *Collector) error {
+		producer, err := kafka.GetProducer()
+		if err != nil {
+			return fmt.Errorf("kafka producer失败: %v", err)
+		}
+		if producer == nil {
+			return fmt.Errorf("kafka producer未初始化")
+		}
+
+		var (
+			namespace = util.FileNameReplace(self.namespace())
+			msgs      = make([]*sarama.ProducerMessage, 0, len(self.dataDocker))
+		)
+		for _, datacell := range self.dataDocker {
+			subNamespace := util.FileNameReplace(self.subNamespace(datacell))
+			topicName := joinNamespaces(namespace, subNamespace)
+			if !topic.MatchString(topicName) {
+				return fmt.Errorf("topic格式要求'^[0-9a-zA-Z_-]+$'，当前为：%s", topicName)
+			}
+
+			titles, values := self.row(datacell)
+			data := make(map[string]interface{}, len(titles))
+			for i, title := range titles {
+				data[title] = values[i]
+			}
+			b, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			msg := &sarama.ProducerMessage{
+				Topic: topicName,
+				Value: sarama.ByteEncoder(b),
+			}
+			if kafkaKeyField != "" {
+				if key, ok := data[kafkaKeyField].(string); ok && key != "" {
+					msg.Key = sarama.StringEncoder(key)
+				}
+			}
+			msgs = append(msgs, msg)
+		}
+		return producer.SendMessages(msgs)
+	}
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/henrylee2cn/pholcus/common/mgo"
+	"github.com/henrylee2cn/pholcus/common/pool"
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/config"
+)
+
+//单次批量插入的最大文档数
+const mgoBatchSize = 1000
+
+/************************ MongoDB 输出 ***************************/
+func init() {
+	DataOutput["mgo"] = func(self *Collector) error {
+		if mgo.Error() != nil {
+			return fmt.Errorf("MongoDB数据库链接失败: %v", mgo.Error())
+		}
+		var (
+			namespace = util.FileNameReplace(self.namespace())
+			dataMap   = make(map[string][]interface{})
+		)
+		for _, datacell := range self.dataDocker {
+			subNamespace := util.FileNameReplace(self.subNamespace(datacell))
+			cName := joinNamespaces(namespace, subNamespace)
+
+			doc := make(map[string]interface{})
+			if vd, ok := datacell["Data"].(map[string]interface{}); ok {
+				for k, v := range vd {
+					doc[k] = v
+				}
+			}
+			if self.Spider.OutDefaultField() {
+				doc["Url"] = datacell["Url"]
+				doc["ParentUrl"] = datacell["ParentUrl"]
+				doc["DownloadTime"] = datacell["DownloadTime"]
+			}
+			dataMap[cName] = append(dataMap[cName], doc)
+		}
+
+		return mgo.Call(func(src pool.Src) error {
+			db := src.(*mgo.MgoSrc).DB(config.DB_NAME)
+			for cName, docs := range dataMap {
+				c := db.C(cName)
+				for i := 0; i < len(docs); i += mgoBatchSize {
+					end := i + mgoBatchSize
+					if end > len(docs) {
+						end = len(docs)
+					}
+					if err := c.Insert(docs[i:end]...); err != nil {
+						return fmt.Errorf("MongoDB集合 %s 插入失败: %v", cName, err)
+					}
+				}
+			}
+			return nil
+		})
+	}
+}
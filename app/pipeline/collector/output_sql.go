@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/l-dandelion/gospider/app/aid/sqldb"
+	"github.com/l-dandelion/gospider/app/pipeline/collector/data"
+	"github.com/l-dandelion/gospider/app/spider"
+)
+
+//同一张表、同一规则的一批待写入数据
+type sqlBatch struct {
+	table string
+	rule  *spider.Rule
+	types map[string]data.FieldType
+	cells []data.DataCell
+}
+
+/************************ MySQL、PostgreSQL、SQLite 输出 ***************************/
+func init() {
+	for _, name := range []string{"mysql", "postgres", "sqlite"} {
+		name := name
+		DataOutput[name] = func(self *Collector) error {
+			return outputSql(self, name)
+		}
+	}
+}
+
+func outputSql(self *Collector, name string) error {
+	db, err := sqldb.Get(name)
+	if err != nil {
+		return fmt.Errorf("%s数据库链接失败: %v", name, err)
+	}
+
+	var (
+		namespace = util.FileNameReplace(self.namespace())
+		batches   = make(map[string]*sqlBatch)
+		order     []string
+	)
+	for _, datacell := range self.dataDocker {
+		ruleName := datacell["RuleName"].(string)
+		tName := joinNamespaces(namespace, util.FileNameReplace(self.subNamespace(datacell)))
+		key := tName + "\x00" + ruleName
+		b, ok := batches[key]
+		if !ok {
+			b = &sqlBatch{
+				table: tName,
+				rule:  self.MustGetRule(ruleName),
+				types: make(map[string]data.FieldType),
+			}
+			batches[key] = b
+			order = append(order, key)
+		}
+		for field, t := range datacell.FieldTypes() {
+			if _, ok := b.types[field]; !ok {
+				b.types[field] = t
+			}
+		}
+		b.cells = append(b.cells, datacell)
+	}
+
+	var firstErr error
+	for _, key := range order {
+		if err := batches[key].write(db, self.Spider.OutDefaultField()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (self *sqlBatch) write(db *sqldb.DB, outDefaultField bool) error {
+	fields := append([]string{}, self.rule.ItemFields...)
+	if outDefaultField {
+		fields = append(fields, "Url", "ParentUrl", "DownloadTime")
+	}
+	if err := db.Ensure(self.tableDef(db, fields)); err != nil {
+		return fmt.Errorf("表 %s 结构更新失败: %v", self.table, err)
+	}
+
+	var upsertKey, update []string
+	if schema := self.rule.Schema; schema != nil && schema.UpsertKey != "" {
+		upsertKey = []string{schema.UpsertKey}
+		for _, f := range fields {
+			if f != schema.UpsertKey && !inStrings(schema.PrimaryKey, f) {
+				update = append(update, f)
+			}
+		}
+	}
+
+	rows := make([][]interface{}, 0, len(self.cells))
+	for _, datacell := range self.cells {
+		vd, _ := datacell["Data"].(map[string]interface{})
+		row := make([]interface{}, 0, len(fields))
+		for _, f := range self.rule.ItemFields {
+			row = append(row, sqldb.Value(vd[f], self.types[f]))
+		}
+		if outDefaultField {
+			row = append(row, datacell["Url"], datacell["ParentUrl"], datacell["DownloadTime"])
+		}
+		rows = append(rows, row)
+	}
+	if err := db.Insert(self.table, fields, rows, upsertKey, update); err != nil {
+		return fmt.Errorf("写入表 %s 失败: %v", self.table, err)
+	}
+	return nil
+}
+
+/**
+  表结构：列类型以Schema中声明的优先，其次按字段类型推断；UpsertKey需有唯一索引
+  未声明类型的文本列若用于主键或索引，使用可建立索引的短文本类型
+*/
+func (self *sqlBatch) tableDef(db *sqldb.DB, fields []string) *sqldb.Table {
+	t := &sqldb.Table{Name: self.table}
+	schema := self.rule.Schema
+	keys := schema.KeyColumns()
+	for _, f := range fields {
+		typ, ok := schema.ColumnType(f)
+		if !ok {
+			switch f {
+			case "Url", "ParentUrl", "DownloadTime":
+				typ = db.KeyText()
+			default:
+				typ = db.ColumnType(self.types[f])
+				if keys[f] && typ == db.ColumnType(data.TYPE_STRING) {
+					typ = db.KeyText()
+				}
+			}
+		}
+		t.Columns = append(t.Columns, sqldb.Column{Name: f, Type: typ})
+	}
+	if schema == nil {
+		return t
+	}
+	t.PrimaryKey = schema.PrimaryKey
+	t.UniqueKeys = schema.UniqueKeys
+	t.Indexes = schema.Indexes
+	if schema.UpsertKey != "" && !(len(schema.PrimaryKey) == 1 && schema.PrimaryKey[0] == schema.UpsertKey) {
+		t.UniqueKeys = append(append([][]string{}, t.UniqueKeys...), []string{schema.UpsertKey})
+	}
+	return t
+}
+
+func inStrings(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package collector
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/l-dandelion/gospider/app/pipeline/collector/data"
+	"github.com/l-dandelion/gospider/app/spider"
+)
+
+var testFields = []string{"name", "count", "ok", "at"}
+
+//在临时目录中创建收集器，文本输出写入该目录
+func newTestCollector(t *testing.T) *Collector {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return NewCollector(&spider.Spider{
+		Name:            "test",
+		NotDefaultField: true,
+		RuleTree: &spider.RuleTree{
+			Trunk: map[string]*spider.Rule{"rule": {ItemFields: testFields}},
+		},
+	})
+}
+
+//写入一批数据
+func flushBatch(t *testing.T, c *Collector, out string, items ...map[string]interface{}) {
+	c.dataDocker = c.dataDocker[:0]
+	for _, item := range items {
+		cell := data.GetDataCell("rule", item, "http://example.com/", "", "")
+		cell.SetFieldTypes(map[string]data.FieldType{
+			"name":  data.TYPE_STRING,
+			"count": data.TYPE_INT,
+			"ok":    data.TYPE_BOOL,
+			"at":    data.TYPE_TIME,
+		})
+		c.dataDocker = append(c.dataDocker, cell)
+	}
+	c.sum[0], c.sum[1] = c.sum[1], c.sum[1]+uint64(len(items))
+	if err := DataOutput[out](c); err != nil {
+		t.Fatalf("%s output: %v", out, err)
+	}
+}
+
+func item(name string, count int, ok bool) map[string]interface{} {
+	return map[string]interface{}{
+		"name":  name,
+		"count": count,
+		"ok":    ok,
+		"at":    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestCSVOutput(t *testing.T) {
+	c := newTestCollector(t)
+	flushBatch(t, c, "csv", item("a", 1, true), item("b,\"quoted\"", 2, false))
+	flushBatch(t, c, "csv", item("c", 3, true))
+
+	dir := textDir("test", "rule")
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("%d files in %s, want 1", len(files), dir)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "data.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(b), "\xEF\xBB\xBF") != 1 || !strings.HasPrefix(string(b), "\xEF\xBB\xBF") {
+		t.Error("BOM should be written once at the start of the file")
+	}
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(b), "\xEF\xBB\xBF"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		testFields,
+		{"a", "1", "true", "2020-01-02 03:04:05"},
+		{"b,\"quoted\"", "2", "false", "2020-01-02 03:04:05"},
+		{"c", "3", "true", "2020-01-02 03:04:05"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d: %q", len(rows), len(want), rows)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestJSONLOutput(t *testing.T) {
+	c := newTestCollector(t)
+	flushBatch(t, c, "jsonl", item("a", 1, true))
+	flushBatch(t, c, "jsonl", item("b", 2, false))
+
+	f, err := os.Open(filepath.Join(textDir("test", "rule"), "data.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var obj map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &obj); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		if _, ok := obj["Url"]; ok {
+			t.Error("default fields should be omitted")
+		}
+		names = append(names, obj["name"].(string))
+		if obj["count"] != float64(len(names)) {
+			t.Errorf("count = %v, want %d", obj["count"], len(names))
+		}
+	}
+	if strings.Join(names, ",") != "a,b" {
+		t.Errorf("names = %v, want [a b]", names)
+	}
+}
+
+func TestXlsxCell(t *testing.T) {
+	emoji := "\U0001F600"
+	cases := []struct {
+		name string
+		v    interface{}
+		t    data.FieldType
+		kind byte
+		want string
+	}{
+		{"int", 42, data.TYPE_INT, xlsxNumber, "42"},
+		{"negative int64", int64(-7), data.TYPE_INT, xlsxNumber, "-7"},
+		{"float", 1.5, data.TYPE_FLOAT, xlsxNumber, "1.5"},
+		{"json float", float64(3), data.TYPE_INT, xlsxNumber, "3"},
+		{"long int as text", int64(1234567890123456789), data.TYPE_INT, xlsxString, "1234567890123456789"},
+		{"nan as text", math.NaN(), data.TYPE_FLOAT, xlsxString, "NaN"},
+		{"true", true, data.TYPE_BOOL, xlsxBool, "1"},
+		{"false", false, data.TYPE_BOOL, xlsxBool, "0"},
+		{"time", time.Date(1900, 3, 1, 12, 0, 0, 0, time.UTC), data.TYPE_TIME, xlsxTime, "61.5"},
+		{"rfc3339 time", "2020-01-02T06:00:00Z", data.TYPE_TIME, xlsxTime, "43832.25"},
+		{"time text", "2020-01-02T06:00:00Z", data.TYPE_STRING, xlsxString, "2020-01-02T06:00:00Z"},
+		{"string", "abc", data.TYPE_STRING, xlsxString, "abc"},
+		{"nil", nil, data.TYPE_STRING, xlsxString, ""},
+		{"long string", strings.Repeat("a", xlsxMaxChars+10), data.TYPE_STRING, xlsxString, strings.Repeat("a", xlsxMaxChars)},
+		{"surrogate pair kept whole", strings.Repeat("a", xlsxMaxChars-1) + emoji, data.TYPE_STRING, xlsxString, strings.Repeat("a", xlsxMaxChars-1)},
+		{"json", []int{1, 2}, data.TYPE_JSON, xlsxString, "[1,2]"},
+	}
+	for _, c := range cases {
+		cell := newXlsxCell(c.v, c.t)
+		if cell.kind != c.kind || cell.value != c.want {
+			got := cell.value
+			if len(got) > 40 {
+				got = got[:40] + "..."
+			}
+			t.Errorf("%s: got kind %d %q, want kind %d", c.name, cell.kind, got, c.kind)
+		}
+	}
+}
+
+func TestExcelOutput(t *testing.T) {
+	defer func(n int) { xlsxMaxRows = n }(xlsxMaxRows)
+	xlsxMaxRows = 3
+
+	c := newTestCollector(t)
+	flushBatch(t, c, "excel", item("a", 1, true), item("b", 2, false), item("c<&>", 3, true))
+
+	dir := textDir("test", "")
+	z, err := zip.OpenReader(filepath.Join(dir, "0-3.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+	parts := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(r)
+		r.Close()
+		parts[f.Name] = string(b)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "xl/workbook.xml", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="rule(2)"`) {
+		t.Errorf("overflowing rows should go to sheet rule(2): %s", parts["xl/workbook.xml"])
+	}
+
+	sheet1 := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">name</t></is></c>`,
+		`<c r="B2"><v>1</v></c>`,
+		`<c r="C2" t="b"><v>1</v></c>`,
+		`<c r="D2" s="1"><v>43832.12783564815</v></c>`,
+		`<c r="C3" t="b"><v>0</v></c>`,
+	} {
+		if !strings.Contains(sheet1, want) {
+			t.Errorf("sheet1 lacks %s", want)
+		}
+	}
+	if strings.Contains(sheet1, `<row r="4">`) {
+		t.Errorf("sheet1 has more than %d rows", xlsxMaxRows)
+	}
+
+	sheet2 := parts["xl/worksheets/sheet2.xml"]
+	for _, want := range []string{
+		`<t xml:space="preserve">name</t>`,
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">c&lt;&amp;&gt;</t></is></c>`,
+		`<c r="B2"><v>3</v></c>`,
+	} {
+		if !strings.Contains(sheet2, want) {
+			t.Errorf("sheet2 lacks %s", want)
+		}
+	}
+}
@@ -1,7 +1,15 @@
 package collector
 
 import (
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/config"
 	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+	"github.com/l-dandelion/gospider/app/pipeline/collector/data"
 )
 
 func (self *Collector) namespace() string {
@@ -34,3 +42,60 @@ func joinNamespaces(namespace, subNamespace string) string {
 	}
 	return namespace + "__" + subNamespace
 }
+
+//文本输出的目录：TEXT_DIR/任务开始时间/namespace__subNamespace
+func textDir(namespace, subNamespace string) string {
+	return filepath.Join(config.TEXT_DIR, cache.StartTime.Format("2006-01-02 150405"), joinNamespaces(namespace, subNamespace))
+}
+
+//按规则字段顺序生成一行数据；开启默认字段时追加Url、ParentUrl、DownloadTime
+func (self *Collector) row(datacell data.DataCell) (titles []string, values []string) {
+	titles, raw, types := self.fields(datacell)
+	values = make([]string, len(raw))
+	for i, v := range raw {
+		values[i] = formatValue(v, types[i])
+	}
+	return
+}
+
+//按规则字段顺序取出原始字段值及其类型，默认字段均为字符串
+func (self *Collector) fields(datacell data.DataCell) (titles []string, values []interface{}, types []data.FieldType) {
+	vd, _ := datacell["Data"].(map[string]interface{})
+	fieldTypes := datacell.FieldTypes()
+	for _, title := range self.MustGetRule(datacell["RuleName"].(string)).ItemFields {
+		titles = append(titles, title)
+		values = append(values, vd[title])
+		types = append(types, fieldTypes[title])
+	}
+	if self.Spider.OutDefaultField() {
+		titles = append(titles, "Url", "ParentUrl", "DownloadTime")
+		values = append(values, datacell["Url"], datacell["ParentUrl"], datacell["DownloadTime"])
+		types = append(types, data.TYPE_STRING, data.TYPE_STRING, data.TYPE_STRING)
+	}
+	return
+}
+
+//将字段值转为文本：时间为 2006-01-02 15:04:05 格式，布尔与数值为字面值，其余非字符串值以JSON表示
+func formatValue(v interface{}, t data.FieldType) string {
+	switch v2 := v.(type) {
+	case nil:
+		return ""
+	case string:
+		if t == data.TYPE_TIME {
+			//经分布式节点传输后时间以RFC3339文本表示
+			if tm, err := time.Parse(time.RFC3339Nano, v2); err == nil {
+				return tm.Format("2006-01-02 15:04:05")
+			}
+		}
+		return v2
+	case time.Time:
+		return v2.Format("2006-01-02 15:04:05")
+	case bool:
+		return strconv.FormatBool(v2)
+	case float64:
+		return strconv.FormatFloat(v2, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v2), 'f', -1, 32)
+	}
+	return util.JsonString(v)
+}
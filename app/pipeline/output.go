@@ -5,6 +5,7 @@ import (
 	"github.com/henrylee2cn/pholcus/common/mgo"
 	"github.com/henrylee2cn/pholcus/common/mysql"
 	"github.com/henrylee2cn/pholcus/runtime/cache"
+	"github.com/l-dandelion/gospider/app/aid/sqldb"
 	"github.com/l-dandelion/gospider/app/pipeline/collector"
 	"sort"
 )
@@ -22,6 +23,9 @@ func RefreshOutput() {
 		mgo.Refresh()
 	case "mysql":
 		mysql.Refresh()
+		sqldb.Refresh("mysql")
+	case "postgres", "sqlite":
+		sqldb.Refresh(cache.Task.OutType)
 	case "kafka":
 		kafka.Refresh()
 	}
@@ -11,6 +11,8 @@ type Pipeline interface {
 	Stop()
 	CollectData(data.DataCell) error
 	CollectFile(data.FileCell) error
+	DataNum() uint64
+	FileNum() uint64
 }
 
 func New(sp *spider.Spider) Pipeline {
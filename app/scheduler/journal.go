@@ -0,0 +1,265 @@
+package scheduler
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/l-dandelion/gospider/app/downloader/request"
+)
+
+/**
+  请求队列的磁盘日志，用于中断后恢复采集
+  每行一条记录，"+"开头为入队的序列化请求，"-"开头为已处理完毕的请求ID，
+  重新打开时回放日志，入队而未处理完毕的请求即为待恢复的请求，按入队顺序恢复；
+  已处理记录过多时自动压缩，全部处理完毕后删除日志文件。
+  每条记录写入后即交给操作系统，进程崩溃不会丢失；
+  每隔journalSyncInterval落盘一次，主机宕机时至多丢失该时长内的记录。
+*/
+type journal struct {
+	fileName string
+	file     *os.File
+	writer   *bufio.Writer
+	pending  map[string]*journalEntry //[reqUnique]待处理请求
+	seq      uint64                   //入队序号
+	records  int                      //日志中的记录数
+	dirty    bool                     //有尚未落盘的记录
+	stop     chan bool
+	sync.Mutex
+}
+
+type journalEntry struct {
+	seq uint64
+	req string //序列化请求
+}
+
+const (
+	journalPush = '+'
+	journalDone = '-'
+	//已处理记录超过该值且多于待处理记录时压缩日志
+	journalCompactMin = 10000
+	//定时落盘的间隔
+	journalSyncInterval = time.Second
+)
+
+var queueDir string
+
+//设置请求队列日志的保存目录，为空时不持久化请求队列
+func SetQueueDir(dir string) {
+	queueDir = dir
+}
+
+func journalFileName(spiderName, spiderSubName string) string {
+	name := spiderName
+	if spiderSubName != "" {
+		name += "__" + spiderSubName
+	}
+	return filepath.Join(queueDir, util.FileNameReplace(name)+".queue")
+}
+
+//打开日志并返回待恢复的请求
+func openJournal(fileName string) (*journal, []*request.Request, error) {
+	self := &journal{
+		fileName: fileName,
+		pending:  make(map[string]*journalEntry),
+		stop:     make(chan bool),
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0777); err != nil {
+		return nil, nil, err
+	}
+	if err := self.replay(); err != nil {
+		return nil, nil, err
+	}
+	if err := self.compact(); err != nil {
+		return nil, nil, err
+	}
+
+	var reqs []*request.Request
+	for _, key := range self.order() {
+		req, err := request.UnSerialize(self.pending[key].req)
+		if err != nil {
+			logs.Log.Error(" *     Fail [恢复请求队列]: %v\n", err)
+			delete(self.pending, key)
+			continue
+		}
+		reqs = append(reqs, req)
+	}
+	go self.syncLoop()
+	return self, reqs, nil
+}
+
+//待处理请求的reqUnique，按入队顺序排列
+func (self *journal) order() []string {
+	keys := make([]string, 0, len(self.pending))
+	for key := range self.pending {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return self.pending[keys[i]].seq < self.pending[keys[j]].seq
+	})
+	return keys
+}
+
+//记录待处理请求，重复入队时按最后一次入队的顺序
+func (self *journal) add(key, s string) {
+	self.seq++
+	self.pending[key] = &journalEntry{seq: self.seq, req: s}
+}
+
+func (self *journal) replay() error {
+	f, err := os.Open(self.fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 2 {
+			continue
+		}
+		switch line[0] {
+		case journalPush:
+			req, err := request.UnSerialize(line[1:])
+			if err != nil {
+				//崩溃时写了一半的记录
+				continue
+			}
+			self.add(req.Unique(), line[1:])
+		case journalDone:
+			delete(self.pending, line[1:])
+		}
+	}
+	return scanner.Err()
+}
+
+//将待处理请求重写为新日志，原子替换旧文件
+func (self *journal) compact() error {
+	if self.file != nil {
+		self.writer.Flush()
+		self.file.Close()
+		self.file = nil
+	}
+	tmpName := self.fileName + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0777)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, key := range self.order() {
+		w.WriteByte(journalPush)
+		w.WriteString(self.pending[key].req)
+		w.WriteByte('\n')
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmpName, self.fileName); err != nil {
+		return err
+	}
+
+	f, err = os.OpenFile(self.fileName, os.O_APPEND|os.O_WRONLY, 0777)
+	if err != nil {
+		return err
+	}
+	self.file = f
+	self.writer = bufio.NewWriter(f)
+	self.records = len(self.pending)
+	self.dirty = false
+	return nil
+}
+
+func (self *journal) write(typ byte, s string) {
+	self.writer.WriteByte(typ)
+	self.writer.WriteString(s)
+	self.writer.WriteByte('\n')
+	if err := self.writer.Flush(); err != nil {
+		logs.Log.Error(" *     Fail [请求队列日志][%v]: %v\n", self.fileName, err)
+	}
+	self.records++
+	self.dirty = true
+}
+
+//定时将日志落盘，直到日志关闭
+func (self *journal) syncLoop() {
+	ticker := time.NewTicker(journalSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.stop:
+			return
+		case <-ticker.C:
+			self.Lock()
+			if self.file != nil && self.dirty {
+				if err := self.file.Sync(); err != nil {
+					logs.Log.Error(" *     Fail [请求队列日志][%v]: %v\n", self.fileName, err)
+				}
+				self.dirty = false
+			}
+			self.Unlock()
+		}
+	}
+}
+
+func (self *journal) push(req *request.Request) {
+	self.Lock()
+	defer self.Unlock()
+	if self.file == nil {
+		return
+	}
+	s := req.Serialize()
+	self.add(req.Unique(), s)
+	self.write(journalPush, s)
+}
+
+func (self *journal) done(req *request.Request) {
+	self.Lock()
+	defer self.Unlock()
+	if self.file == nil {
+		return
+	}
+	if _, ok := self.pending[req.Unique()]; !ok {
+		return
+	}
+	delete(self.pending, req.Unique())
+	self.write(journalDone, req.Unique())
+
+	if done := self.records - len(self.pending); done > journalCompactMin && done > len(self.pending) {
+		if err := self.compact(); err != nil {
+			logs.Log.Error(" *     Fail [压缩请求队列日志][%v]: %v\n", self.fileName, err)
+		}
+	}
+}
+
+//关闭日志，无待处理请求时删除日志文件
+func (self *journal) close() {
+	self.Lock()
+	defer self.Unlock()
+	if self.file == nil {
+		return
+	}
+	close(self.stop)
+	self.writer.Flush()
+	self.file.Sync()
+	self.file.Close()
+	self.file = nil
+	if len(self.pending) == 0 {
+		os.Remove(self.fileName)
+		return
+	}
+	logs.Log.Informational(" *     [请求队列日志]: 剩余 %v 条待处理请求，已保存至 %v\n", len(self.pending), self.fileName)
+}
@@ -0,0 +1,207 @@
+package scheduler
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/l-dandelion/gospider/app/downloader/request"
+)
+
+func newRequest(t *testing.T, rawurl string) *request.Request {
+	req := &request.Request{Spider: "spider", Rule: "rule", Url: rawurl}
+	if err := req.Prepare(); err != nil {
+		t.Fatalf("Prepare(%q): %v", rawurl, err)
+	}
+	return req
+}
+
+func countLines(t *testing.T, fileName string) int {
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+	}
+	return n
+}
+
+func TestJournalReplay(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "spider.queue")
+	urls := []string{
+		"http://example.com/1",
+		"http://example.com/2",
+		"http://example.com/3",
+		"http://example.com/4",
+	}
+
+	cases := []struct {
+		name string
+		run  func(j *journal, reqs []*request.Request)
+		tail string //模拟崩溃时写了一半的记录
+		want []int  //恢复的请求在urls中的下标
+	}{
+		{
+			name: "fifo",
+			run: func(j *journal, reqs []*request.Request) {
+				for _, req := range reqs {
+					j.push(req)
+				}
+			},
+			want: []int{0, 1, 2, 3},
+		},
+		{
+			name: "done removed",
+			run: func(j *journal, reqs []*request.Request) {
+				for _, req := range reqs {
+					j.push(req)
+				}
+				j.done(reqs[1])
+				j.done(reqs[3])
+			},
+			want: []int{0, 2},
+		},
+		{
+			name: "repush moves to end",
+			run: func(j *journal, reqs []*request.Request) {
+				for _, req := range reqs[:3] {
+					j.push(req)
+				}
+				j.done(reqs[0])
+				j.push(reqs[0])
+			},
+			want: []int{1, 2, 0},
+		},
+		{
+			name: "partial record",
+			run: func(j *journal, reqs []*request.Request) {
+				j.push(reqs[2])
+				j.push(reqs[0])
+			},
+			tail: "+{\"Spider\":\"spi",
+			want: []int{2, 0},
+		},
+	}
+
+	for _, c := range cases {
+		os.Remove(fileName)
+		j, restored, err := openJournal(fileName)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(restored) != 0 {
+			t.Fatalf("%s: new journal restored %d requests", c.name, len(restored))
+		}
+		reqs := make([]*request.Request, len(urls))
+		for i, u := range urls {
+			reqs[i] = newRequest(t, u)
+		}
+		c.run(j, reqs)
+		j.close()
+		if c.tail != "" {
+			f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0777)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.WriteString(c.tail)
+			f.Close()
+		}
+
+		j, restored, err = openJournal(fileName)
+		if err != nil {
+			t.Fatalf("%s: reopen: %v", c.name, err)
+		}
+		if len(restored) != len(c.want) {
+			t.Errorf("%s: restored %d requests, want %d", c.name, len(restored), len(c.want))
+		} else {
+			for i, idx := range c.want {
+				if restored[i].GetUrl() != urls[idx] {
+					t.Errorf("%s: restored[%d] = %s, want %s", c.name, i, restored[i].GetUrl(), urls[idx])
+				}
+			}
+		}
+		//重新打开时已压缩为仅含待处理请求
+		if n := countLines(t, fileName); n != len(c.want) {
+			t.Errorf("%s: compacted journal has %d lines, want %d", c.name, n, len(c.want))
+		}
+		j.close()
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "spider.queue")
+	j, _, err := openJournal(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keep := newRequest(t, "http://example.com/keep")
+	j.push(keep)
+	for i := 0; i <= journalCompactMin; i++ {
+		req := newRequest(t, "http://example.com/done?i="+strconv.Itoa(i))
+		j.push(req)
+		j.done(req)
+	}
+	if written := 1 + 2*(journalCompactMin+1); j.records >= written {
+		t.Errorf("journal was not compacted: %d records of %d written", j.records, written)
+	}
+	j.close()
+
+	j, restored, err := openJournal(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.close()
+	if len(restored) != 1 || restored[0].GetUrl() != keep.GetUrl() {
+		t.Errorf("restored %v, want only %s", restored, keep.GetUrl())
+	}
+}
+
+func TestJournalRemovedWhenDrained(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "spider.queue")
+	j, _, err := openJournal(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := newRequest(t, "http://example.com/1")
+	j.push(req)
+	j.done(req)
+	j.close()
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("drained journal still exists: %v", err)
+	}
+}
+
+func TestRequeueKeepsJournal(t *testing.T) {
+	j, _, err := openJournal(filepath.Join(t.TempDir(), "spider.queue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.close()
+	m := &Matrix{
+		reqs:     make(map[int][]*request.Request),
+		requeued: make(map[*request.Request]bool),
+		journal:  j,
+	}
+	req := newRequest(t, "http://example.com/1")
+	j.push(req)
+
+	//等待期间中断，日志记录仍在
+	m.Requeue(req, time.Hour)
+	m.Done(req)
+	if _, ok := j.pending[req.Unique()]; !ok {
+		t.Fatal("requeued request was removed from the journal")
+	}
+
+	//再次处理完毕后删除
+	m.Done(req)
+	if _, ok := j.pending[req.Unique()]; ok {
+		t.Error("processed request is still in the journal")
+	}
+}
@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/l-dandelion/gospider/app/downloader/request"
+)
+
+//单次Pull在每个优先级队列中最多检查的请求数，避免同一主机受限时遍历整个队列
+const pullScanLimit = 1000
+
+type (
+	//按主机限制并发数与请求间隔，所有蜘蛛共享
+	hostLimiter struct {
+		hosts map[string]*hostState
+		sync.Mutex
+	}
+
+	hostState struct {
+		active    int           //正在下载的请求数
+		lastStart time.Time     //最近一次放行的时间
+		minDelay  time.Duration //主机级别的最小间隔下限（如robots.txt的Crawl-delay）
+	}
+)
+
+func newHostLimiter() *hostLimiter {
+	return &hostLimiter{
+		hosts: make(map[string]*hostState),
+	}
+}
+
+func hostOf(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+func (self *hostLimiter) state(host string) *hostState {
+	s, ok := self.hosts[host]
+	if !ok {
+		s = &hostState{}
+		self.hosts[host] = s
+	}
+	return s
+}
+
+//尝试为请求占用主机配额，limit<=0时不限并发，delay<=0时不限间隔
+func (self *hostLimiter) acquire(host string, limit int, delay time.Duration, now time.Time) bool {
+	self.Lock()
+	defer self.Unlock()
+	s := self.state(host)
+	if limit > 0 && s.active >= limit {
+		return false
+	}
+	if delay < s.minDelay {
+		delay = s.minDelay
+	}
+	if delay > 0 && now.Sub(s.lastStart) < delay {
+		return false
+	}
+	s.active++
+	s.lastStart = now
+	return true
+}
+
+func (self *hostLimiter) release(host string) {
+	self.Lock()
+	defer self.Unlock()
+	if s, ok := self.hosts[host]; ok && s.active > 0 {
+		s.active--
+	}
+}
+
+func (self *hostLimiter) setMinDelay(host string, delay time.Duration) {
+	self.Lock()
+	defer self.Unlock()
+	self.state(strings.ToLower(host)).minDelay = delay
+}
+
+//设置主机的最小请求间隔下限，对所有蜘蛛生效
+func SetHostMinDelay(host string, delay time.Duration) {
+	sdl.hosts.setMinDelay(host, delay)
+}
+
+//请求的主机配额，请求自身设置优先于蜘蛛设置
+func (self *Matrix) hostQuota(req *request.Request) (int, time.Duration) {
+	limit, delay := self.hostLimit, self.hostDelay
+	if req.GetHostLimit() > 0 {
+		limit = req.GetHostLimit()
+	}
+	if req.GetHostDelay() > 0 {
+		delay = req.GetHostDelay()
+	}
+	return limit, delay
+}
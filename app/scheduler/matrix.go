@@ -10,38 +10,54 @@ import (
 	"github.com/henrylee2cn/pholcus/runtime/cache"
 	"github.com/henrylee2cn/pholcus/runtime/status"
 	"github.com/l-dandelion/gospider/app/aid/history"
+	"github.com/l-dandelion/gospider/app/aid/metrics"
 	"github.com/l-dandelion/gospider/app/downloader/request"
 )
 
 type Matrix struct {
 	maxPage         int64                       //最大采集页数
 	resCount        int32                       //资源使用情况计数
+	queued          int64                       //队列中的请求数，Push暂停等待时持有锁，故单独计数
+	delayed         int32                       //等待稍后放回队列的请求数
 	spiderName      string                      //所属spider
+	spiderSubName   string                      //所属spider的二级标识，即自定义配置的简写
 	reqs            map[int][]*request.Request  //[优先级]队列,优先级默认为0
 	priorities      []int                       //优先级顺序，从低到高
 	history         history.Historier           //历史记录
 	tempHistory     map[string]bool             //临时记录 [reqUnique(url + method)] true
 	failures        map[string]*request.Request //历史及本次失败请求
+	hostLimit       int                         //同一主机的最大并发数，0为不限
+	hostDelay       time.Duration               //同一主机两次请求的最小间隔，0为不限
+	journal         *journal                    //请求队列的磁盘日志，未开启持久化时为nil
+	requeued        map[*request.Request]bool   //已放回队列、其日志记录须保留的请求
 	tempHistoryLock sync.RWMutex
 	failureLock     sync.Mutex
+	requeueLock     sync.Mutex
 	sync.Mutex
 }
 
-func newMatrix(spiderName, spiderSubName string, maxPage int64) *Matrix {
+func newMatrix(spiderName, spiderSubName string, maxPage int64, recrawl time.Duration) *Matrix {
 	matrix := &Matrix{
-		spiderName:  spiderName,
-		maxPage:     maxPage,
-		reqs:        make(map[int][]*request.Request),
-		priorities:  []int{},
-		history:     history.New(spiderName, spiderSubName),
-		tempHistory: make(map[string]bool),
-		failures:    make(map[string]*request.Request),
-	}
-	if cache.Task.Mode != status.SERVER {
+		spiderName:    spiderName,
+		spiderSubName: spiderSubName,
+		maxPage:       maxPage,
+		reqs:          make(map[int][]*request.Request),
+		priorities:    []int{},
+		history:       history.New(spiderName, spiderSubName),
+		tempHistory:   make(map[string]bool),
+		failures:      make(map[string]*request.Request),
+		requeued:      make(map[*request.Request]bool),
+	}
+	matrix.history.SetRecrawl(recrawl)
+	//分布式运行时由主节点持有历史记录
+	if cache.Task.Mode != status.CLIENT {
 		matrix.history.ReadSuccess(cache.Task.OutType, cache.Task.SuccessInherit)
 		matrix.history.ReadFailure(cache.Task.OutType, cache.Task.FailureInherit)
 		matrix.setFailures(matrix.history.PullFailure())
 	}
+	if queueDir != "" {
+		matrix.openJournal(spiderName, spiderSubName)
+	}
 	return matrix
 }
 
@@ -75,11 +91,28 @@ func (self *Matrix) Push(req *request.Request) {
 
 	if !req.IsReloadable() {
 		if self.hasHistory(req.Unique()) {
+			metrics.IncDedupHit(self.spiderName)
 			return
 		}
 		self.insertTempHistory(req.Unique())
+		//成功记录已过期，以条件请求重新采集
+		if rec := self.history.GetSuccess(req.Unique()); rec != nil {
+			if rec.ETag != "" {
+				req.SetHeader("If-None-Match", rec.ETag)
+			}
+			if rec.LastModified != "" {
+				req.SetHeader("If-Modified-Since", rec.LastModified)
+			}
+		}
 	}
 
+	if self.journal != nil {
+		self.journal.push(req)
+	}
+	self.enqueue(req)
+}
+
+func (self *Matrix) enqueue(req *request.Request) {
 	var priority = req.GetPriority()
 
 	if _, found := self.reqs[priority]; !found {
@@ -89,10 +122,62 @@ func (self *Matrix) Push(req *request.Request) {
 	}
 
 	self.reqs[priority] = append(self.reqs[priority], req)
+	atomic.AddInt64(&self.queued, 1)
+	metrics.AddQueue(self.spiderName, self.spiderSubName, priority, 1)
 
 	atomic.AddInt64(&self.maxPage, 1)
 }
 
+/**
+  delay之后将已出队的请求重新放回队列，不做去重，也不计入最大采集页数
+  用于暂时无法处理、需稍后重试的请求，等待期间蜘蛛不会因队列为空而结束
+  其日志记录一直保留，等待期间中断时该请求可在下次启动时恢复
+*/
+func (self *Matrix) Requeue(req *request.Request, delay time.Duration) {
+	atomic.AddInt32(&self.delayed, 1)
+	self.requeueLock.Lock()
+	self.requeued[req] = true
+	self.requeueLock.Unlock()
+	time.AfterFunc(delay, func() {
+		defer atomic.AddInt32(&self.delayed, -1)
+		self.Lock()
+		defer self.Unlock()
+		if sdl.checkStatus(status.STOP) {
+			return
+		}
+		self.enqueue(req)
+		atomic.AddInt64(&self.maxPage, -1)
+	})
+}
+
+//打开请求队列日志，并恢复上次未处理完毕的请求
+func (self *Matrix) openJournal(spiderName, spiderSubName string) {
+	fileName := journalFileName(spiderName, spiderSubName)
+	j, reqs, err := openJournal(fileName)
+	if err != nil {
+		logs.Log.Error(" *     Fail [打开请求队列日志][%v]: %v\n", fileName, err)
+		return
+	}
+	self.journal = j
+	for _, req := range reqs {
+		if !req.IsReloadable() {
+			self.insertTempHistory(req.Unique())
+		}
+		self.enqueue(req)
+	}
+	if len(reqs) > 0 {
+		logs.Log.Informational(" *     [恢复请求队列]: %v 条\n", len(reqs))
+	}
+}
+
+//关闭请求队列日志，并清除队列指标
+func (self *Matrix) Close() {
+	metrics.ResetQueue(self.spiderName, self.spiderSubName, self.priorities)
+	if self.journal != nil {
+		self.journal.close()
+	}
+}
+
 func (self *Matrix) Pull() (req *request.Request) {
 	self.Lock()
 	defer self.Unlock()
@@ -101,22 +186,55 @@ func (self *Matrix) Pull() (req *request.Request) {
 		return
 	}
 
+	now := time.Now()
 	for i := len(self.reqs) - 1; i >= 0; i-- {
 		idx := self.priorities[i]
-		if len(self.reqs[idx]) > 0 {
-			req = self.reqs[idx][0]
-			self.reqs[idx] = self.reqs[idx][1:]
-			if sdl.useProxy {
-				req.SetProxy(sdl.proxy.GetOne(req.GetUrl()))
-			} else {
-				req.SetProxy("")
+		queue := self.reqs[idx]
+		blocked := map[string]bool{}
+		for j := 0; j < len(queue) && j < pullScanLimit; j++ {
+			host := hostOf(queue[j].GetUrl())
+			if blocked[host] {
+				continue
+			}
+			limit, delay := self.hostQuota(queue[j])
+			if !sdl.hosts.acquire(host, limit, delay, now) {
+				blocked[host] = true
+				continue
 			}
+			req = queue[j]
+			//将前j个请求后移一位再丢弃队首，开销与j相关而与队列长度无关
+			copy(queue[1:j+1], queue[:j])
+			queue[0] = nil
+			self.reqs[idx] = queue[1:]
+			atomic.AddInt64(&self.queued, -1)
+			metrics.AddQueue(self.spiderName, self.spiderSubName, idx, -1)
+			AssignProxy(req)
 			return
 		}
 	}
 	return
 }
 
+//设置同一主机的最大并发数与最小请求间隔
+func (self *Matrix) SetHostLimit(limit int, delay time.Duration) {
+	self.Lock()
+	defer self.Unlock()
+	self.hostLimit = limit
+	self.hostDelay = delay
+}
+
+//请求处理结束，释放其占用的主机配额；已放回队列的请求保留其日志记录
+func (self *Matrix) Done(req *request.Request) {
+	sdl.hosts.release(hostOf(req.GetUrl()))
+	self.requeueLock.Lock()
+	requeued := self.requeued[req]
+	delete(self.requeued, req)
+	self.requeueLock.Unlock()
+	if self.journal != nil && !requeued {
+		self.journal.done(req)
+	}
+}
+
 func (self *Matrix) Use() {
 	defer func() {
 		recover()
@@ -131,22 +249,41 @@ func (self *Matrix) Free() {
 }
 
 func (self *Matrix) DoHistory(req *request.Request, ok bool) bool {
+	return self.doHistory(req, ok, nil)
+}
+
+//采集成功，并保存本次的采集信息，rec为nil时同DoHistory(req, true)
+func (self *Matrix) DoSuccess(req *request.Request, rec *history.Record) {
+	self.doHistory(req, true, rec)
+}
+
+//开启重新采集时返回该请求上次的采集信息，否则返回nil
+func (self *Matrix) LastRecord(req *request.Request) *history.Record {
+	if req.IsReloadable() {
+		return nil
+	}
+	return self.history.GetSuccess(req.Unique())
+}
+
+func (self *Matrix) doHistory(req *request.Request, ok bool, rec *history.Record) bool {
 	if !req.IsReloadable() {
 		self.tempHistoryLock.Lock()
 		delete(self.tempHistory, req.Unique())
 		self.tempHistoryLock.Unlock()
 		if ok {
-			self.history.UpsertSuccess(req.Unique())
+			self.history.UpsertSuccess(req.Unique(), rec)
 			return false
 		}
 	}
 
+	self.failureLock.Lock()
+	defer self.failureLock.Unlock()
 	if ok {
+		//重试成功，其失败记录随之删除
+		delete(self.failures, req.Unique())
 		return false
 	}
 
-	self.failureLock.Lock()
-	defer self.failureLock.Unlock()
 	if _, ok := self.failures[req.Unique()]; !ok {
 		self.failures[req.Unique()] = req
 		logs.Log.Informational(" *     + 失败请求: [%v]\n", req.GetUrl())
@@ -167,7 +304,7 @@ func (self *Matrix) CanStop() bool {
 	if atomic.LoadInt32(&self.resCount) != 0 {
 		return false
 	}
-	if self.Len() > 0 {
+	if self.Len() > 0 || atomic.LoadInt32(&self.delayed) > 0 {
 		return false
 	}
 
@@ -193,14 +330,21 @@ func (self *Matrix) CanStop() bool {
 }
 
 func (self *Matrix) TryFlushSuccess() {
-	if cache.Task.Mode != status.SERVER && cache.Task.SuccessInherit {
+	if cache.Task.Mode != status.CLIENT && cache.Task.SuccessInherit {
 		self.history.FlushSuccess(cache.Task.OutType)
 	}
 }
 
+//尚待重试的失败请求仍保留其失败记录，重试成功后才会删除
 func (self *Matrix) TryFlushFailure() {
-	if cache.Task.Mode != status.SERVER && cache.Task.FailureInherit {
-		self.history.FlushFailure(cache.Task.OutType)
+	if cache.Task.Mode != status.CLIENT && cache.Task.FailureInherit {
+		self.failureLock.Lock()
+		pending := make(map[string]bool, len(self.failures))
+		for key := range self.failures {
+			pending[key] = true
+		}
+		self.failureLock.Unlock()
+		self.history.FlushFailure(cache.Task.OutType, pending)
 	}
 }
 
@@ -214,14 +358,13 @@ func (self *Matrix) Wait() {
 	}
 }
 
+//正在使用的资源数
+func (self *Matrix) ResCount() int32 {
+	return atomic.LoadInt32(&self.resCount)
+}
+
 func (self *Matrix) Len() int {
-	self.Lock()
-	defer self.Unlock()
-	var l int
-	for _, reqs := range self.reqs {
-		l += len(reqs)
-	}
-	return l
+	return int(atomic.LoadInt64(&self.queued))
 }
 
 func (self *Matrix) hasHistory(reqUnique string) bool {
@@ -8,6 +8,8 @@ import (
 	"github.com/henrylee2cn/pholcus/runtime/cache"
 	"github.com/henrylee2cn/pholcus/runtime/status"
 	"github.com/l-dandelion/gospider/app/aid/proxy"
+	"github.com/l-dandelion/gospider/app/downloader/request"
+	"github.com/l-dandelion/gospider/app/downloader/surfer"
 )
 
 type scheduler struct {
@@ -15,6 +17,7 @@ type scheduler struct {
 	count    chan bool
 	useProxy bool
 	proxy    *proxy.Proxy
+	hosts    *hostLimiter
 	matrices []*Matrix
 	sync.RWMutex
 }
@@ -23,6 +26,7 @@ var sdl = &scheduler{
 	status: status.RUN,
 	count:  make(chan bool, cache.Task.ThreadNum),
 	proxy:  proxy.New(),
+	hosts:  newHostLimiter(),
 }
 
 func Init() {
@@ -31,6 +35,7 @@ func Init() {
 	}
 	sdl.matrices = []*Matrix{}
 	sdl.count = make(chan bool, cache.Task.ThreadNum)
+	sdl.hosts = newHostLimiter()
 
 	if cache.Task.ProxyMinute > 0 {
 		if sdl.proxy.Count() > 0 {
@@ -49,8 +54,53 @@ func Init() {
 	sdl.status = status.RUN
 }
 
-func AddMatrix(spiderName, spiderSubName string, maxPage int64) *Matrix {
-	matrix := newMatrix(spiderName, spiderSubName, maxPage)
+//设置代理服务商的提取接口并重新读取代理
+func SetProxyApi(api string) {
+	sdl.proxy.SetApi(api)
+}
+
+/**
+  为请求分配代理
+  会话中的请求沿用会话绑定的代理；该代理被隔离时重置会话后重新分配，
+  以免同一登录状态出现在不同IP上
+*/
+func (self *scheduler) proxyFor(req *request.Request) string {
+	id := req.GetSession()
+	if id == "" {
+		return self.proxy.GetOne(req.GetUrl())
+	}
+	sess := surfer.GetSession(id)
+	if p := sess.Proxy(); p != "" {
+		if self.proxy.Usable(p, req.GetUrl()) {
+			return p
+		}
+		sess.Reset()
+		logs.Log.Informational(" *     [%v]会话的代理IP已失效，重置会话\n", id)
+	}
+	p := self.proxy.GetOne(req.GetUrl())
+	sess.BindProxy(p)
+	return p
+}
+
+//为请求分配代理，未使用代理时清除其代理
+func AssignProxy(req *request.Request) {
+	if sdl.useProxy {
+		req.SetProxy(sdl.proxyFor(req))
+	} else {
+		req.SetProxy("")
+	}
+}
+
+//将请求的下载结果反馈给代理池
+func ReportProxy(req *request.Request, outcome proxy.Outcome) {
+	if sdl.useProxy {
+		sdl.proxy.Report(req.GetProxy(), req.GetUrl(), outcome)
+	}
+}
+
+//recrawl为成功记录的有效期，0为永不过期
+func AddMatrix(spiderName, spiderSubName string, maxPage int64, recrawl time.Duration) *Matrix {
+	matrix := newMatrix(spiderName, spiderSubName, maxPage, recrawl)
 	sdl.Lock()
 	defer sdl.Unlock()
 	sdl.matrices = append(sdl.matrices, matrix)
@@ -92,6 +142,6 @@ func (self *scheduler) avgRes() int32 {
 func (self *scheduler) checkStatus(s int) bool {
 	self.RLock()
 	b := self.status == s
-	self.RLock()
+	self.RUnlock()
 	return b
 }
@@ -0,0 +1,33 @@
+package spider
+
+import (
+	"bytes"
+
+	"github.com/l-dandelion/gospider/app/aid/proxy"
+)
+
+//页面是否含有蜘蛛设置的封禁标志，如验证码页面
+func (self *Context) Banned() bool {
+	if len(self.spider.BanMarks) == 0 || self.err != nil || self.Response == nil || self.Response.Body == nil {
+		return false
+	}
+	b, err := self.peekBody()
+	if err != nil {
+		return false
+	}
+	for _, mark := range self.spider.BanMarks {
+		if bytes.Contains(b, []byte(mark)) {
+			return true
+		}
+	}
+	return false
+}
+
+//本次下载中代理的使用结果，用于反馈给代理池
+func (self *Context) ProxyOutcome() proxy.Outcome {
+	var statusCode int
+	if self.Response != nil {
+		statusCode = self.Response.StatusCode
+	}
+	return proxy.Judge(statusCode, self.err, self.Banned())
+}
@@ -77,11 +77,14 @@ func (self *Context) AddQueue(req *request.Request) *Context {
 
 	err := req.SetSpiderName(self.spider.GetName()).
 		SetEnableCookie(self.spider.GetEnableCookie()).
+		SetCanonicalizer(self.spider.Canonicalizer).
+		SetCookieScope(self.spider.cookieScope()).
 		Prepare()
 	if err != nil {
 		logs.Log.Error(err.Error())
 		return self
 	}
+	self.spider.assignSession(req, self.Request)
 
 	if req.GetReferer() == "" && self.Response != nil {
 		req.SetReferer(self.GetUrl())
@@ -111,6 +114,9 @@ func (self *Context) JsAddQueue(jreq map[string]interface{}) *Context {
 		}
 	}
 	req.PostData, _ = jreq["PostData"].(string)
+	if body, ok := jreq["Body"].(string); ok {
+		req.Body = []byte(body)
+	}
 	req.Reloadable, _ = jreq["Reloadable"].(bool)
 	if t, ok := jreq["DialTimeout"].(int64); ok {
 		req.DialTimeout = time.Duration(t)
@@ -127,24 +133,35 @@ func (self *Context) JsAddQueue(jreq map[string]interface{}) *Context {
 	if t, ok := jreq["RedirectTimes"].(int64); ok {
 		req.RedirectTimes = int(t)
 	}
+	if t, ok := jreq["HostLimit"].(int64); ok {
+		req.HostLimit = int(t)
+	}
+	if t, ok := jreq["HostDelay"].(int64); ok {
+		req.HostDelay = time.Duration(t)
+	}
 	if t, ok := jreq["Priority"].(int64); ok {
 		req.Priority = int(t)
 	}
 	if t, ok := jreq["DownloaderID"].(int64); ok {
 		req.DownloaderID = int(t)
 	}
+	req.Downloader, _ = jreq["Downloader"].(string)
+	req.Session, _ = jreq["Session"].(string)
 	if t, ok := jreq["Temp"].(map[string]interface{}); ok {
 		req.Temp = t
 	}
 	err := req.
 		SetSpiderName(self.spider.GetName()).
 		SetEnableCookie(self.spider.GetEnableCookie()).
+		SetCanonicalizer(self.spider.Canonicalizer).
+		SetCookieScope(self.spider.cookieScope()).
 		Prepare()
 
 	if err != nil {
 		logs.Log.Error(err.Error())
 		return self
 	}
+	self.spider.assignSession(req, self.Request)
 
 	if req.GetReferer() == "" && self.Response != nil {
 		req.SetReferer(self.GetUrl())
@@ -153,13 +170,17 @@ func (self *Context) JsAddQueue(jreq map[string]interface{}) *Context {
 	return self
 }
 
+//输出结果数据，item可为 map[int]interface{}、map[string]interface{}、request.Temp，或带 gospider 标签的结构体及其指针
 func (self *Context) Output(item interface{}, ruleName ...string) {
 	_ruleName, rule, found := self.getRule(ruleName...)
 	if !found {
 		logs.Log.Error("蜘蛛 %s 调用Output()时，指定的规则名不存在!", self.spider.GetName())
 		return
 	}
-	var _item map[string]interface{}
+	var (
+		_item map[string]interface{}
+		types map[string]data.FieldType
+	)
 	switch item2 := item.(type) {
 	case map[int]interface{}:
 		_item = self.CreateItem(item2, _ruleName)
@@ -173,13 +194,24 @@ func (self *Context) Output(item interface{}, ruleName ...string) {
 			self.spider.UpsertItemField(rule, k)
 		}
 		_item = item2
+	default:
+		var ok bool
+		if _item, types, ok = self.spider.structItem(rule, item); !ok {
+			logs.Log.Error("蜘蛛 %s 调用Output()时，不支持的结果类型 %T！", self.spider.GetName(), item)
+			return
+		}
 	}
-	self.Lock()
+	var cell data.DataCell
 	if self.spider.NotDefaultField {
-		self.items = append(self.items, data.GetDataCell(_ruleName, _item, "", "", ""))
+		cell = data.GetDataCell(_ruleName, _item, "", "", "")
 	} else {
-		self.items = append(self.items, data.GetDataCell(_ruleName, _item, self.GetUrl(), self.GetReferer(), time.Now().Format("2006-01-02 15:04:05")))
+		cell = data.GetDataCell(_ruleName, _item, self.GetUrl(), self.GetReferer(), time.Now().Format("2006-01-02 15:04:05"))
 	}
+	if types != nil {
+		cell.SetFieldTypes(types)
+	}
+	self.Lock()
+	self.items = append(self.items, cell)
 	self.Unlock()
 }
 
@@ -488,6 +520,22 @@ func (self *Context) initDom() *goquery.Document {
 	return self.dom
 }
 
+//读取响应的全部内容，读取后Body仍可正常读取；读取出错时，之后读取Body会得到同样的错误
+func (self *Context) peekBody() ([]byte, error) {
+	b, err := ioutil.ReadAll(self.Response.Body)
+	self.Response.Body.Close()
+	if err != nil {
+		self.Response.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(b), errReader{err}))
+		return b, err
+	}
+	self.Response.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+type errReader struct{ err error }
+
+func (self errReader) Read([]byte) (int, error) { return 0, self.err }
+
 func (self *Context) initText() {
 	var err error
 	if self.Request.DownloaderID == request.SURF_ID {
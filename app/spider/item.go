@@ -0,0 +1,83 @@
+package spider
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/l-dandelion/gospider/app/pipeline/collector/data"
+)
+
+//结构体结果中的字段，按声明顺序排列
+type structField struct {
+	name  string         //输出的字段名，取自 gospider 标签，未设置时为字段名
+	index []int          //reflect.Value.FieldByIndex 的索引
+	typ   data.FieldType //字段类型
+}
+
+var structFields sync.Map //[reflect.Type][]structField
+
+/**
+  解析结构体的输出字段
+  标签 `gospider:"名称"` 指定字段名，`gospider:"-"` 忽略该字段；
+  未导出字段忽略，匿名嵌入的结构体字段展开到外层
+*/
+func getStructFields(t reflect.Type) []structField {
+	if fields, ok := structFields.Load(t); ok {
+		return fields.([]structField)
+	}
+	fields := parseStructFields(t, nil)
+	structFields.Store(t, fields)
+	return fields
+}
+
+func parseStructFields(t reflect.Type, parent []int) (fields []structField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+		tag := f.Tag.Get("gospider")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct && data.TypeOf(f.Type) == data.TYPE_JSON {
+			fields = append(fields, parseStructFields(f.Type, index)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.TrimSpace(tag)
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, structField{
+			name:  name,
+			index: index,
+			typ:   data.TypeOf(f.Type),
+		})
+	}
+	return
+}
+
+//将结构体（或其指针）转为结果数据，并按声明顺序登记字段；item不是结构体时ok为false
+func (self *Spider) structItem(rule *Rule, item interface{}) (_item map[string]interface{}, types map[string]data.FieldType, ok bool) {
+	v := reflect.ValueOf(item)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, nil, false
+	}
+	fields := getStructFields(v.Type())
+	_item = make(map[string]interface{}, len(fields))
+	types = make(map[string]data.FieldType, len(fields))
+	for _, f := range fields {
+		self.UpsertItemField(rule, f.name)
+		_item[f.name] = v.FieldByIndex(f.index).Interface()
+		types[f.name] = f.typ
+	}
+	return _item, types, true
+}
@@ -0,0 +1,93 @@
+package spider
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/l-dandelion/gospider/app/downloader/request"
+)
+
+/**
+  登录步骤，采集开始时在RuleTree.Root之前执行
+  采集过程中发现登录失效时，重新登录并重试该请求，而不记为失败；
+  使用会话池时各会话分别登录。登录所得cookie按蜘蛛的cookie隔离范围保存。
+  分布式运行时不生效
+*/
+type Login struct {
+	Request      *request.Request    //登录请求，通常以POST或POST-M提交账号密码；每次登录时使用其副本
+	Verify       func(*Context) bool //判断登录是否成功，为nil时只要下载成功即视为成功
+	ExpiredCodes []int               //表示登录已失效的响应状态码，如401
+	ExpiredMarks []string            //页面含有其中任一字符串时视为登录已失效，如登录表单的特征
+	Expired      func(*Context) bool //自定义的登录失效判断，与上两者任一满足即视为失效
+}
+
+//是否需要登录
+func (self *Spider) NeedLogin() bool {
+	return self.RuleTree.Login != nil && self.RuleTree.Login.Request != nil
+}
+
+//需登录的会话ID：未使用会话池时为蜘蛛的默认cookie（空ID），否则为会话池中的各会话
+func (self *Spider) SessionIds() []string {
+	if self.Sessions <= 0 {
+		return []string{""}
+	}
+	ids := make([]string, self.Sessions)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i)
+	}
+	return ids
+}
+
+//生成指定会话的登录请求
+func (self *Spider) LoginRequest(session string) (*request.Request, error) {
+	req := self.RuleTree.Login.Request.Copy()
+	req.Session = session
+	req.Reloadable = true
+	err := req.SetSpiderName(self.GetName()).
+		SetEnableCookie(true).
+		SetCanonicalizer(self.Canonicalizer).
+		SetCookieScope(self.cookieScope()).
+		Prepare()
+	return req, err
+}
+
+//登录请求的响应是否表示登录成功
+func (self *Context) LoginVerified() bool {
+	if self.err != nil {
+		return false
+	}
+	verify := self.spider.RuleTree.Login.Verify
+	return verify == nil || verify(self)
+}
+
+//响应是否表示登录已失效
+func (self *Context) LoginExpired() bool {
+	login := self.spider.RuleTree.Login
+	if login == nil || self.Response == nil {
+		return false
+	}
+	for _, code := range login.ExpiredCodes {
+		if self.Response.StatusCode == code {
+			return true
+		}
+	}
+	if self.err != nil || self.Response.Body == nil {
+		return false
+	}
+	if login.Expired != nil && login.Expired(self) {
+		return true
+	}
+	if len(login.ExpiredMarks) == 0 {
+		return false
+	}
+	b, err := self.peekBody()
+	if err != nil {
+		return false
+	}
+	for _, mark := range login.ExpiredMarks {
+		if bytes.Contains(b, []byte(mark)) {
+			return true
+		}
+	}
+	return false
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/henrylee2cn/pholcus/config"
 	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/l-dandelion/gospider/app/downloader/request"
 	"github.com/robertkrimen/otto"
 )
 
@@ -20,6 +21,9 @@ type (
 		EnableLimit     bool        `xml:"EnableLimit"`
 		EnableKeyin     bool        `xml:"EnableKeyin"`
 		EnableCookie    bool        `xml:"EnableCookie"`
+		ObeyRobots      bool        `xml:"ObeyRobots"`
+		RobotsUserAgent string      `xml:"RobotsUserAgent"`
+		Canonicalize    bool        `xml:"Canonicalize"`
 		NotDefaultField bool        `xml:"NotDefaultField"`
 		Namespace       string      `xml:"Namespace"`
 		SubNamespace    string      `xml:"SubNamespace"`
@@ -41,6 +45,8 @@ func init() {
 			Description:     m.Description,
 			PauseTime:       m.Pausetime,
 			EnableCookie:    m.EnableCookie,
+			ObeyRobots:      m.ObeyRobots,
+			RobotsUserAgent: m.RobotsUserAgent,
 			NotDefaultField: m.NotDefaultField,
 			RuleTree:        &RuleTree{Trunk: map[string]*Rule{}},
 		}
@@ -50,6 +56,9 @@ func init() {
 		if m.EnableKeyin {
 			sp.Keyin = KEYIN
 		}
+		if m.Canonicalize {
+			sp.Canonicalizer = request.DefaultCanonicalizer
+		}
 
 		if m.Namespace != "" {
 			sp.Namespace = func(self *Spider) string {
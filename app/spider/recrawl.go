@@ -0,0 +1,57 @@
+package spider
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/l-dandelion/gospider/app/aid/history"
+	"github.com/l-dandelion/gospider/app/downloader/request"
+)
+
+//服务器返回304，但没有上次采集的记录可沿用
+var ErrNoRecord = errors.New("服务器返回304，但没有上次采集的记录")
+
+/**
+  重新采集时，根据响应生成本次的采集信息
+  服务器返回304，或页面内容与上次采集时相同，则unchanged为true，无需再次解析
+  返回304而last为nil时没有页面内容可沿用，返回ErrNoRecord
+*/
+func (self *Context) Revisit(last *history.Record) (rec *history.Record, unchanged bool, err error) {
+	resp := self.Response
+	rec = &history.Record{
+		Time:         time.Now().Unix(),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		if last == nil {
+			return nil, false, ErrNoRecord
+		}
+		if rec.ETag == "" {
+			rec.ETag = last.ETag
+		}
+		if rec.LastModified == "" {
+			rec.LastModified = last.LastModified
+		}
+		rec.Hash = last.Hash
+		return rec, true, nil
+	}
+
+	b, err := self.peekBody()
+	if err != nil {
+		return rec, false, nil
+	}
+	sum := md5.Sum(b)
+	rec.Hash = hex.EncodeToString(sum[:])
+	return rec, last != nil && last.Hash == rec.Hash, nil
+}
+
+//去除条件请求头，使服务器返回完整页面
+func DropConditional(req *request.Request) {
+	req.GetHeader().Del("If-None-Match")
+	req.GetHeader().Del("If-Modified-Since")
+}
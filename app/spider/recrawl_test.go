@@ -0,0 +1,116 @@
+package spider
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/l-dandelion/gospider/app/aid/history"
+	"github.com/l-dandelion/gospider/app/downloader/request"
+)
+
+func hash(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRevisit(t *testing.T) {
+	last := &history.Record{Hash: hash("old"), ETag: `"v1"`, LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}
+	cases := []struct {
+		name      string
+		code      int
+		header    http.Header
+		body      string
+		last      *history.Record
+		unchanged bool
+		err       error
+		want      history.Record //Time不比较
+	}{
+		{
+			name:      "304 keeps last record",
+			code:      http.StatusNotModified,
+			header:    http.Header{},
+			last:      last,
+			unchanged: true,
+			want:      history.Record{Hash: last.Hash, ETag: last.ETag, LastModified: last.LastModified},
+		},
+		{
+			name:      "304 with new etag",
+			code:      http.StatusNotModified,
+			header:    http.Header{"Etag": {`"v2"`}},
+			last:      last,
+			unchanged: true,
+			want:      history.Record{Hash: last.Hash, ETag: `"v2"`, LastModified: last.LastModified},
+		},
+		{
+			name:   "304 without last record",
+			code:   http.StatusNotModified,
+			header: http.Header{},
+			err:    ErrNoRecord,
+		},
+		{
+			name:      "same body",
+			code:      http.StatusOK,
+			header:    http.Header{"Etag": {`"v3"`}},
+			body:      "old",
+			last:      last,
+			unchanged: true,
+			want:      history.Record{Hash: hash("old"), ETag: `"v3"`},
+		},
+		{
+			name:   "changed body",
+			code:   http.StatusOK,
+			header: http.Header{},
+			body:   "new",
+			last:   last,
+			want:   history.Record{Hash: hash("new")},
+		},
+		{
+			name:   "first visit",
+			code:   http.StatusOK,
+			header: http.Header{"Last-Modified": {"Tue, 03 Jan 2006 15:04:05 GMT"}},
+			body:   "new",
+			want:   history.Record{Hash: hash("new"), LastModified: "Tue, 03 Jan 2006 15:04:05 GMT"},
+		},
+	}
+	for _, c := range cases {
+		ctx := GetContext(nil, &request.Request{Url: "http://example.com/"})
+		ctx.SetResponse(&http.Response{
+			StatusCode: c.code,
+			Header:     c.header,
+			Body:       ioutil.NopCloser(strings.NewReader(c.body)),
+		})
+		rec, unchanged, err := ctx.Revisit(c.last)
+		if err != c.err || unchanged != c.unchanged {
+			t.Errorf("%s: unchanged = %v, err = %v; want %v, %v", c.name, unchanged, err, c.unchanged, c.err)
+		}
+		if c.err == nil {
+			if rec == nil || rec.Hash != c.want.Hash || rec.ETag != c.want.ETag || rec.LastModified != c.want.LastModified {
+				t.Errorf("%s: record = %+v, want %+v", c.name, rec, c.want)
+			}
+			//正文仍可供解析
+			if b, _ := ioutil.ReadAll(ctx.Response.Body); string(b) != c.body {
+				t.Errorf("%s: body = %q after Revisit, want %q", c.name, b, c.body)
+			}
+		}
+		PutContext(ctx)
+	}
+}
+
+func TestDropConditional(t *testing.T) {
+	req := &request.Request{Url: "http://example.com/"}
+	if err := req.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	req.SetHeader("If-None-Match", `"v1"`)
+	req.SetHeader("If-Modified-Since", "Mon, 02 Jan 2006 15:04:05 GMT")
+	req.SetHeader("Accept", "text/html")
+	DropConditional(req)
+	h := req.GetHeader()
+	if h.Get("If-None-Match") != "" || h.Get("If-Modified-Since") != "" || h.Get("Accept") != "text/html" {
+		t.Errorf("headers after DropConditional = %v", h)
+	}
+}
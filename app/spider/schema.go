@@ -0,0 +1,42 @@
+package spider
+
+/**
+  结果数据在数据库中的表结构，设置于Rule.Schema
+  未在Columns中声明的字段按结果的类型推断列类型（结构体结果），无法推断时为文本；
+  用于主键、索引或UpsertKey的文本字段为可建立索引的短文本，如MySQL的VARCHAR(255)
+*/
+type Schema struct {
+	Columns    map[string]string //字段名 -> 列类型，如 "VARCHAR(64) NOT NULL"；默认字段Url、ParentUrl、DownloadTime亦可覆盖
+	PrimaryKey []string          //主键字段，未设置时使用自增的id列
+	UniqueKeys [][]string        //唯一索引，每项为一组字段
+	Indexes    [][]string        //普通索引，每项为一组字段
+	UpsertKey  string            //设置后以该字段去重写入，已存在的行更新为最新数据；该字段非主键时自动建立唯一索引
+}
+
+func (self *Schema) ColumnType(field string) (string, bool) {
+	if self == nil {
+		return "", false
+	}
+	t, ok := self.Columns[field]
+	return t, ok
+}
+
+//用于主键、索引或UpsertKey的字段
+func (self *Schema) KeyColumns() map[string]bool {
+	keys := make(map[string]bool)
+	if self == nil {
+		return keys
+	}
+	for _, f := range self.PrimaryKey {
+		keys[f] = true
+	}
+	for _, group := range append(append([][]string{}, self.UniqueKeys...), self.Indexes...) {
+		for _, f := range group {
+			keys[f] = true
+		}
+	}
+	if self.UpsertKey != "" {
+		keys[self.UpsertKey] = true
+	}
+	return keys
+}
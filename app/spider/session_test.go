@@ -0,0 +1,75 @@
+package spider
+
+import (
+	"testing"
+
+	"github.com/l-dandelion/gospider/app/downloader/request"
+)
+
+func TestAssignSession(t *testing.T) {
+	cases := []struct {
+		name     string
+		sessions int
+		parent   string   //父请求的会话，"-"表示没有父请求
+		preset   []string //各请求预先指定的会话
+		want     []string
+	}{
+		{"no pool", 0, "-", []string{"", ""}, []string{"", ""}},
+		{"round robin", 3, "-", []string{"", "", "", "", ""}, []string{"0", "1", "2", "0", "1"}},
+		{"inherit parent", 3, "2", []string{"", ""}, []string{"2", "2"}},
+		{"inherit without pool", 0, "x", []string{""}, []string{"x"}},
+		{"parent without session", 2, "", []string{"", ""}, []string{"0", "1"}},
+		{"explicit session kept", 2, "1", []string{"a", "", "b"}, []string{"a", "1", "b"}},
+		//指定会话的请求不占用轮流分配的序号
+		{"explicit not counted", 2, "-", []string{"a", "", "", ""}, []string{"a", "0", "1", "0"}},
+	}
+	for _, c := range cases {
+		sp := &Spider{Sessions: c.sessions}
+		var parent *request.Request
+		if c.parent != "-" {
+			parent = &request.Request{Session: c.parent}
+		}
+		for i, preset := range c.preset {
+			req := &request.Request{Session: preset}
+			sp.assignSession(req, parent)
+			if req.Session != c.want[i] {
+				t.Errorf("%s: request %d got session %q, want %q", c.name, i, req.Session, c.want[i])
+			}
+		}
+	}
+}
+
+//经AddQueue加入的请求沿用当前页面的会话，入口请求轮流分配
+func TestAddQueueSession(t *testing.T) {
+	var pushed []*request.Request
+	sp := (&Spider{
+		Name:     "session_test",
+		Sessions: 2,
+		RuleTree: &RuleTree{
+			Root:  func(*Context) {},
+			Trunk: map[string]*Rule{"page": {}},
+		},
+	}).Register()
+	sp.SetRequestSink(func(req *request.Request) { pushed = append(pushed, req) })
+
+	root := GetContext(sp, nil)
+	for i := 0; i < 3; i++ {
+		root.AddQueue(&request.Request{Url: "http://example.com/root", Rule: "page"})
+	}
+	PutContext(root)
+
+	page := GetContext(sp, &request.Request{Url: "http://example.com/root", Rule: "page", Session: "1"})
+	page.AddQueue(&request.Request{Url: "http://example.com/child", Rule: "page"})
+	page.AddQueue(&request.Request{Url: "http://example.com/other", Rule: "page", Session: "0"})
+	PutContext(page)
+
+	want := []string{"0", "1", "0", "1", "0"}
+	if len(pushed) != len(want) {
+		t.Fatalf("pushed %d requests, want %d", len(pushed), len(want))
+	}
+	for i, req := range pushed {
+		if req.Session != want[i] {
+			t.Errorf("request %d (%s) got session %q, want %q", i, req.GetUrl(), req.Session, want[i])
+		}
+	}
+}
@@ -2,13 +2,20 @@ package spider
 
 import (
 	"math"
+	"path"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/henrylee2cn/pholcus/common/util"
+	"github.com/henrylee2cn/pholcus/config"
 	"github.com/henrylee2cn/pholcus/logs"
 	"github.com/henrylee2cn/pholcus/runtime/status"
+	"github.com/l-dandelion/gospider/app/aid/dedup"
+	"github.com/l-dandelion/gospider/app/aid/history"
 	"github.com/l-dandelion/gospider/app/downloader/request"
+	"github.com/l-dandelion/gospider/app/downloader/surfer"
 	"github.com/l-dandelion/gospider/app/scheduler"
 )
 
@@ -23,6 +30,18 @@ type (
 		Name            string
 		Description     string
 		PauseTime       int64
+		HostLimit       int                    //同一主机的最大并发数，0为不限
+		HostDelay       time.Duration          //同一主机两次请求的最小间隔，0为不限
+		ObeyRobots      bool                   //是否遵守robots.txt
+		RobotsUserAgent string                 //匹配robots.txt时使用的User-agent，为空时使用默认值
+		Canonicalizer   *request.Canonicalizer //去重前的URL规范化规则，为nil时不规范化
+		RecrawlTTL      time.Duration          //成功记录的有效期，过期后以条件请求重新采集，0为永不过期；开启后成功记录全部保存在内存中
+		PageDedup       *dedup.Config          //按页面内容去重，nil为不去重；分布式运行时不生效
+		BanMarks        []string               //页面含有其中任一字符串时视为被封禁（如验证码页面），记为失败并隔离所用代理
+		Sessions        int                    //会话池大小，大于0时未指定会话的请求轮流分配到各会话，会话绑定cookie、User-Agent与代理
+		CookiePerKeyin  bool                   //cookie按自定义配置(Keyin)隔离，默认同一蜘蛛共用
+		CookieFile      string                 //启动时载入的cookie文件，支持Netscape格式的cookies.txt与JSON格式
+		SaveCookies     bool                   //结束时保存cookie（含各会话），下次启动时自动载入，无需重新登录
 		Limit           int64
 		Keyin           string
 		EnableCookie    bool
@@ -35,6 +54,9 @@ type (
 		id        int //自动分配的SpiderQueue中的索引
 		subName   string
 		reqMatrix *scheduler.Matrix
+		reqSink   func(*request.Request) //设置后新请求交由其处理，不进入调度队列
+		pages     *dedup.Filter          //本次采集的页面内容
+		sessionNo uint64                 //已分配会话的请求数，用于轮流分配
 		timer     *Timer
 		status    int
 		lock      sync.RWMutex
@@ -42,6 +64,7 @@ type (
 	}
 
 	RuleTree struct {
+		Login *Login //登录步骤，可选
 		Root  func(*Context)
 		Trunk map[string]*Rule
 	}
@@ -50,6 +73,8 @@ type (
 		ItemFields []string                                           //结果字段列表
 		ParseFunc  func(*Context)                                     //内容解析函数
 		AidFunc    func(*Context, map[string]interface{}) interface{} //通用辅助函数
+		Schema     *Schema                                            //结果在数据库中的表结构，可选
+		ItemDedup  *dedup.Config                                      //按结果数据的内容去重，nil为不去重
 	}
 )
 
@@ -164,6 +189,7 @@ func (self *Spider) Copy() *Spider {
 	ghost.subName = self.subName
 
 	ghost.RuleTree = &RuleTree{
+		Login: self.RuleTree.Login,
 		Root:  self.RuleTree.Root,
 		Trunk: make(map[string]*Rule, len(self.RuleTree.Trunk)),
 	}
@@ -176,10 +202,24 @@ func (self *Spider) Copy() *Spider {
 
 		ghost.RuleTree.Trunk[k].ParseFunc = v.ParseFunc
 		ghost.RuleTree.Trunk[k].AidFunc = v.AidFunc
+		ghost.RuleTree.Trunk[k].Schema = v.Schema
+		ghost.RuleTree.Trunk[k].ItemDedup = v.ItemDedup
 	}
 
 	ghost.Description = self.Description
 	ghost.PauseTime = self.PauseTime
+	ghost.HostLimit = self.HostLimit
+	ghost.HostDelay = self.HostDelay
+	ghost.ObeyRobots = self.ObeyRobots
+	ghost.RobotsUserAgent = self.RobotsUserAgent
+	ghost.Canonicalizer = self.Canonicalizer
+	ghost.RecrawlTTL = self.RecrawlTTL
+	ghost.PageDedup = self.PageDedup
+	ghost.BanMarks = self.BanMarks
+	ghost.Sessions = self.Sessions
+	ghost.CookiePerKeyin = self.CookiePerKeyin
+	ghost.CookieFile = self.CookieFile
+	ghost.SaveCookies = self.SaveCookies
 	ghost.EnableCookie = self.EnableCookie
 	ghost.Limit = self.Limit
 	ghost.Keyin = self.Keyin
@@ -194,22 +234,111 @@ func (self *Spider) Copy() *Spider {
 
 func (self *Spider) ReqmatrixInit() *Spider {
 	if self.Limit < 0 {
-		self.reqMatrix = scheduler.AddMatrix(self.GetName(), self.GetSubName(), self.Limit)
+		self.reqMatrix = scheduler.AddMatrix(self.GetName(), self.GetSubName(), self.Limit, self.RecrawlTTL)
 		self.SetLimit(0)
 	} else {
-		self.reqMatrix = scheduler.AddMatrix(self.GetName(), self.GetSubName(), math.MinInt64)
+		self.reqMatrix = scheduler.AddMatrix(self.GetName(), self.GetSubName(), math.MinInt64, self.RecrawlTTL)
 	}
+	self.reqMatrix.SetHostLimit(self.HostLimit, self.HostDelay)
+	if self.PageDedup != nil {
+		self.pages = dedup.New(self.PageDedup)
+	}
+	self.loadCookies()
 	return self
 }
 
+//cookie的隔离范围
+func (self *Spider) cookieScope() string {
+	if self.CookiePerKeyin && self.GetKeyin() != "" {
+		return self.GetName() + "#" + self.GetKeyin()
+	}
+	return self.GetName()
+}
+
+//SaveCookies保存cookie的文件
+func (self *Spider) cookieFileName() string {
+	return path.Join(config.CACHE_DIR, "cookies", util.FileNameReplace(self.cookieScope())+".json")
+}
+
+//载入CookieFile与上次保存的cookie，后者覆盖前者中的同名cookie；共用隔离范围的副本只载入一次
+func (self *Spider) loadCookies() {
+	scope := self.cookieScope()
+	if !surfer.AcquireJar(scope) {
+		return
+	}
+	if self.CookieFile != "" {
+		n, err := surfer.SeedCookies(scope, self.CookieFile)
+		if err != nil {
+			logs.Log.Error(" *     Fail [载入cookie][%v]: %v\n", self.CookieFile, err)
+		} else {
+			logs.Log.Informational(" *     [载入cookie][%v]: %v 条\n", self.CookieFile, n)
+		}
+	}
+	if self.SaveCookies {
+		if err := surfer.LoadCookies(scope, self.cookieFileName()); err != nil {
+			logs.Log.Error(" *     Fail [恢复cookie][%v]: %v\n", self.cookieFileName(), err)
+		}
+	}
+}
+
+//页面内容是否与本次已采集的页面重复，未开启页面去重时返回false
+func (self *Spider) DuplicatePage(ctx *Context) bool {
+	if self.pages == nil {
+		return false
+	}
+	body, err := ctx.peekBody()
+	if err != nil {
+		return false
+	}
+	return self.pages.Seen(body)
+}
+
+//为未指定会话的请求分配会话：沿用父请求的会话，否则从会话池中轮流分配
+func (self *Spider) assignSession(req *request.Request, parent *request.Request) {
+	if req.Session != "" {
+		return
+	}
+	if parent != nil && parent.Session != "" {
+		req.Session = parent.Session
+	} else if self.Sessions > 0 {
+		n := atomic.AddUint64(&self.sessionNo, 1) - 1
+		req.Session = strconv.FormatUint(n%uint64(self.Sessions), 10)
+	}
+}
+
 func (self *Spider) DoHistory(req *request.Request, ok bool) bool {
 	return self.reqMatrix.DoHistory(req, ok)
 }
 
+//采集成功，并保存本次的采集信息
+func (self *Spider) DoSuccess(req *request.Request, rec *history.Record) {
+	self.reqMatrix.DoSuccess(req, rec)
+}
+
+//开启重新采集时返回该请求上次的采集信息，否则返回nil
+func (self *Spider) LastRecord(req *request.Request) *history.Record {
+	return self.reqMatrix.LastRecord(req)
+}
+
 func (self *Spider) RequestPush(req *request.Request) {
+	if self.reqSink != nil {
+		self.reqSink(req)
+		return
+	}
 	self.reqMatrix.Push(req)
 }
 
+//稍后将已出队的请求重新放回队列
+func (self *Spider) RequestRequeue(req *request.Request, delay time.Duration) {
+	self.reqMatrix.Requeue(req, delay)
+}
+
+//截留解析过程中添加的新请求，用于分布式节点将其交还主节点调度
+func (self *Spider) SetRequestSink(sink func(*request.Request)) *Spider {
+	self.reqSink = sink
+	return self
+}
+
 func (self *Spider) RequestPull() *request.Request {
 	return self.reqMatrix.Pull()
 }
@@ -222,10 +351,24 @@ func (self *Spider) RequestFree() {
 	self.reqMatrix.Free()
 }
 
+func (self *Spider) RequestDone(req *request.Request) {
+	self.reqMatrix.Done(req)
+}
+
 func (self *Spider) RequestLen() int {
+	if self.reqMatrix == nil {
+		return 0
+	}
 	return self.reqMatrix.Len()
 }
 
+func (self *Spider) RequestResCount() int32 {
+	if self.reqMatrix == nil {
+		return 0
+	}
+	return self.reqMatrix.ResCount()
+}
+
 func (self *Spider) TryFlushSuccess() {
 	self.reqMatrix.TryFlushSuccess()
 }
@@ -274,6 +417,19 @@ func (self *Spider) Defer() {
 	self.reqMatrix.Wait()
 
 	self.reqMatrix.TryFlushFailure()
+
+	self.reqMatrix.Close()
+
+	//共用隔离范围的副本全部结束后，才保存并移除其cookie
+	if !surfer.ReleaseJar(self.cookieScope()) {
+		return
+	}
+	if self.SaveCookies {
+		if err := surfer.SaveCookies(self.cookieScope(), self.cookieFileName()); err != nil {
+			logs.Log.Error(" *     Fail [保存cookie][%v]: %v\n", self.cookieFileName(), err)
+		}
+	}
+	surfer.CloseJar(self.cookieScope())
 }
 
 func (self *Spider) OutDefaultField() bool {
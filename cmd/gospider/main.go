@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+	"github.com/henrylee2cn/pholcus/runtime/status"
+	"github.com/l-dandelion/gospider/app"
+	"github.com/l-dandelion/gospider/app/aid/history"
+	"github.com/l-dandelion/gospider/app/aid/metrics"
+	"github.com/l-dandelion/gospider/app/aid/proxy"
+	"github.com/l-dandelion/gospider/app/aid/sqldb"
+	"github.com/l-dandelion/gospider/app/distribute"
+	"github.com/l-dandelion/gospider/app/pipeline/collector"
+	"github.com/l-dandelion/gospider/app/scheduler"
+	"github.com/l-dandelion/gospider/app/spider"
+	"github.com/l-dandelion/gospider/web"
+)
+
+var (
+	listFlag        = flag.Bool("list", false, "列出全部已注册的蜘蛛后退出")
+	spidersFlag     = flag.String("spiders", "", "要执行的蜘蛛名称，多个之间以逗号分隔")
+	keyinsFlag      = flag.String("keyins", "", "自定义配置，多个之间以 <> 包裹，如 <a><b>")
+	threadFlag      = flag.Int("thread", 20, "全局最大并发量")
+	pauseFlag       = flag.Int64("pause", 300, "平均暂停时间（毫秒）")
+	limitFlag       = flag.Int64("limit", 0, "采集上限（默认限制URL数）")
+	outTypeFlag     = flag.String("outtype", "", "输出方式："+strings.Join(collector.DataOutputLib, " | "))
+	dockerCapFlag   = flag.Int("dockercap", 10000, "分批输出的容量")
+	proxyFlag       = flag.Int64("proxy", 0, "代理IP更换频率（分钟），为0时不使用代理")
+	proxyApiFlag    = flag.String("proxyapi", "", "代理服务商的提取接口URL，与代理配置文件及环境变量 "+proxy.PROXY_ENV+" 合并使用")
+	successFlag     = flag.Bool("success", true, "继承并保存成功记录")
+	failureFlag     = flag.Bool("failure", true, "继承并保存失败记录")
+	allowFailedPage = flag.Bool("allowfail", false, "存在失败页面时仍以 0 退出")
+	kafkaKeyFlag    = flag.String("kafkakey", "", "kafka 输出时作为分区 key 的字段名")
+	queueDirFlag    = flag.String("queue", "", "请求队列日志目录，设置后可在中断后恢复采集")
+	dedupFlag       = flag.String("dedup", history.STORE_MAP, "成功记录去重存储：map | bloom | disk")
+	dedupCapFlag    = flag.Uint64("dedupcap", 1<<20, "成功记录预计数量，用于 bloom 与 disk 的初始容量")
+	dedupFPFlag     = flag.Float64("dedupfp", 0.0001, "bloom 去重的目标误判率")
+	pgDSNFlag       = flag.String("pgdsn", sqldb.PostgresDSN, "postgres 输出与历史记录的连接串")
+	sqliteFlag      = flag.String("sqlite", sqldb.SqlitePath, "sqlite 输出与历史记录的数据库文件")
+	metricsFlag     = flag.String("metrics", "", "Prometheus 指标监听地址，如 :9100（-web 控制台亦提供 /metrics）")
+	masterFlag      = flag.String("master", "", "作为主节点监听的地址，如 :2015；请求交由工作节点下载解析")
+	workerFlag      = flag.String("worker", "", "作为工作节点连接的主节点地址，如 127.0.0.1:2015")
+	workerIdFlag    = flag.String("workerid", "", "工作节点ID，默认为 主机名-进程号")
+	capacityFlag    = flag.Int("capacity", 10, "工作节点可同时处理的任务数")
+	webFlag         = flag.String("web", "", "控制台监听地址，如 :9090（未指定主机时仅监听本机）；未指定 -spiders 时仅启动控制台")
+	webTokenFlag    = flag.String("webtoken", "", "控制台的访问令牌，设置后需以 Basic 认证密码或 Bearer 令牌提供")
+)
+
+func main() {
+	flag.Parse()
+
+	if *listFlag {
+		for _, sp := range spider.Species.Get() {
+			fmt.Printf("%s\t%s\n", sp.GetName(), sp.GetDescription())
+		}
+		return
+	}
+
+	if *workerFlag != "" {
+		runWorker()
+		return
+	}
+
+	os.Exit(run())
+}
+
+func runWorker() {
+	id := *workerIdFlag
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	cache.Task.Mode = status.CLIENT
+	distribute.NewWorker(id, *workerFlag, *capacityFlag).RunForever(5 * time.Second)
+}
+
+func run() int {
+	outType := *outTypeFlag
+	if outType == "" && len(collector.DataOutputLib) > 0 {
+		outType = collector.DataOutputLib[0]
+	}
+	if i := sort.SearchStrings(collector.DataOutputLib, outType); i == len(collector.DataOutputLib) || collector.DataOutputLib[i] != outType {
+		fmt.Fprintf(os.Stderr, "不支持的输出方式: %s，可选：%s\n", outType, strings.Join(collector.DataOutputLib, " | "))
+		return 2
+	}
+
+	switch *dedupFlag {
+	case history.STORE_MAP, history.STORE_BLOOM, history.STORE_DISK:
+	default:
+		fmt.Fprintf(os.Stderr, "不支持的去重存储: %s\n", *dedupFlag)
+		return 2
+	}
+	history.SetSuccessStore(history.StoreConfig{
+		Kind:          *dedupFlag,
+		Capacity:      *dedupCapFlag,
+		FalsePositive: *dedupFPFlag,
+	})
+	scheduler.SetQueueDir(*queueDirFlag)
+	collector.SetKafkaKeyField(*kafkaKeyFlag)
+	sqldb.PostgresDSN = *pgDSNFlag
+	sqldb.SqlitePath = *sqliteFlag
+	scheduler.SetProxyApi(*proxyApiFlag)
+
+	if *metricsFlag != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			if err := http.ListenAndServe(*metricsFlag, mux); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+
+	if *webFlag != "" {
+		if *spidersFlag == "" {
+			if err := web.Run(*webFlag, *webTokenFlag, app.LogicApp); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			return 0
+		}
+		go func() {
+			if err := web.Run(*webFlag, *webTokenFlag, app.LogicApp); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+
+	if *spidersFlag == "" {
+		fmt.Fprintln(os.Stderr, "未指定蜘蛛，请使用 -spiders 选择，或使用 -list 查看可用蜘蛛")
+		return 2
+	}
+
+	logic := app.LogicApp
+	var sps []*spider.Spider
+	for _, name := range strings.Split(*spidersFlag, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		sp := logic.GetSpiderByName(name)
+		if sp == nil {
+			fmt.Fprintf(os.Stderr, "蜘蛛不存在: %s\n", name)
+			return 2
+		}
+		sps = append(sps, sp)
+	}
+
+	mode := status.OFFLINE
+	if *masterFlag != "" {
+		m, err := distribute.Serve(*masterFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer m.Close()
+		mode = status.SERVER
+	}
+
+	task := &cache.AppConf{
+		Mode:           mode,
+		ThreadNum:      *threadFlag,
+		Pausetime:      *pauseFlag,
+		OutType:        outType,
+		DockerCap:      *dockerCapFlag,
+		Limit:          *limitFlag,
+		ProxyMinute:    *proxyFlag,
+		SuccessInherit: *successFlag,
+		FailureInherit: *failureFlag,
+		Keyins:         *keyinsFlag,
+	}
+
+	if err := logic.SpiderPrepare(sps).Run(task); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		fmt.Fprintln(os.Stderr, "收到终止信号，正在停止任务……")
+		logic.Stop()
+	}()
+
+	summary := logic.Wait()
+	fmt.Printf("共采集数据 %v 条，下载文件 %v 个，成功页数 %v，失败页数 %v，robots.txt禁止 %v，重复页面 %v，重复数据 %v，用时 %v\n",
+		summary.DataNum, summary.FileNum, summary.PageSucc, summary.PageFail, summary.Blocked, summary.DupPages, summary.DupItems, summary.TakeTime)
+
+	if summary.PageFail > 0 && !*allowFailedPage {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+package web
+
+//控制台页面，可选择蜘蛛启动任务，每2秒轮询一次 /api/status
+const dashboard = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gospider</title>
+<style>
+body{font-family:sans-serif;margin:2em;color:#333}
+table{border-collapse:collapse;margin-top:1em}
+th,td{border:1px solid #ccc;padding:4px 10px;text-align:right}
+th:first-child,td:first-child{text-align:left}
+button{margin-right:.5em}
+#status{font-weight:bold}
+#task label{display:inline-block;margin-right:1em;vertical-align:top}
+#msg{color:#c00}
+</style>
+</head>
+<body>
+<h2>gospider</h2>
+<form id="task">
+<label>蜘蛛<br><select id="spiders-select" multiple size="6"></select></label>
+<label>自定义配置<br><input id="keyins" placeholder="&lt;a&gt;&lt;b&gt;"></label>
+<label>采集上限<br><input id="limit" type="number" min="0" value="0"></label>
+<label>并发量<br><input id="thread" type="number" min="1" value="20"></label>
+<label>输出方式<br><select id="outtype"></select></label>
+<label><br><button type="submit">启动</button><span id="msg"></span></label>
+</form>
+<p>状态：<span id="status">-</span>　成功页数：<span id="succ">0</span>　失败页数：<span id="fail">0</span></p>
+<p>
+<button onclick="post('/api/pause')">暂停</button>
+<button onclick="post('/api/resume')">继续</button>
+<button onclick="post('/api/stop')">终止</button>
+</p>
+<table>
+<thead><tr><th>蜘蛛</th><th>自定义配置</th><th>队列长度</th><th>处理中</th><th>数据</th><th>文件</th></tr></thead>
+<tbody id="spiders"></tbody>
+</table>
+<p id="summary"></p>
+<script>
+function post(path){fetch(path,{method:'POST'}).then(refresh)}
+function esc(s){var d=document.createElement('div');d.textContent=s;return d.innerHTML}
+function options(id,list,text){
+  var sel=document.getElementById(id);
+  list.forEach(function(v){var o=document.createElement('option');o.value=text?v.name:v;o.textContent=text?text(v):v;sel.appendChild(o)});
+}
+fetch('/api/spiders').then(function(r){return r.json()}).then(function(list){
+  options('spiders-select',list,function(sp){return sp.description?sp.name+' - '+sp.description:sp.name});
+});
+fetch('/api/outtypes').then(function(r){return r.json()}).then(function(list){options('outtype',list)});
+document.getElementById('task').onsubmit=function(e){
+  e.preventDefault();
+  var names=[].filter.call(document.getElementById('spiders-select').options,function(o){return o.selected}).map(function(o){return o.value});
+  var msg=document.getElementById('msg');
+  msg.textContent='';
+  fetch('/api/task',{method:'POST',headers:{'Content-Type':'application/json'},body:JSON.stringify({
+    spiders:names,
+    keyins:document.getElementById('keyins').value,
+    limit:parseInt(document.getElementById('limit').value,10)||0,
+    threadNum:parseInt(document.getElementById('thread').value,10)||20,
+    outType:document.getElementById('outtype').value
+  })}).then(function(r){return r.json()}).then(function(s){
+    if(s.error){msg.textContent=s.error}
+    refresh();
+  });
+};
+function refresh(){
+  fetch('/api/status').then(function(r){return r.json()}).then(function(s){
+    document.getElementById('status').textContent=s.status;
+    document.getElementById('succ').textContent=s.pageSucc;
+    document.getElementById('fail').textContent=s.pageFail;
+    var rows='';
+    (s.spiders||[]).forEach(function(p){
+      rows+='<tr><td>'+esc(p.name)+'</td><td>'+esc(p.keyin)+'</td><td>'+p.queueLen+'</td><td>'+p.resCount+
+        '</td><td>'+p.dataNum+'</td><td>'+p.fileNum+'</td></tr>';
+    });
+    document.getElementById('spiders').innerHTML=rows;
+    var m=s.summary;
+    document.getElementById('summary').textContent=m&&m.reports?
+      '上次任务：数据 '+m.dataNum+' 条，文件 '+m.fileNum+' 个，用时 '+(m.takeTime/1e9).toFixed(1)+' 秒':'';
+  });
+}
+refresh();
+setInterval(refresh,2000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,279 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/henrylee2cn/pholcus/logs"
+	"github.com/henrylee2cn/pholcus/runtime/cache"
+	"github.com/henrylee2cn/pholcus/runtime/status"
+	"github.com/l-dandelion/gospider/app"
+	"github.com/l-dandelion/gospider/app/aid/metrics"
+	"github.com/l-dandelion/gospider/app/pipeline/collector"
+	"github.com/l-dandelion/gospider/app/spider"
+)
+
+type (
+	//启动任务的请求参数
+	TaskForm struct {
+		Spiders        []string `json:"spiders"`
+		Keyins         string   `json:"keyins"`
+		ThreadNum      int      `json:"threadNum"`
+		Pausetime      int64    `json:"pausetime"`
+		Limit          int64    `json:"limit"`
+		OutType        string   `json:"outType"`
+		DockerCap      int      `json:"dockerCap"`
+		ProxyMinute    int64    `json:"proxyMinute"`
+		SuccessInherit bool     `json:"successInherit"`
+		FailureInherit bool     `json:"failureInherit"`
+	}
+
+	SpiderInfo struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		EnableKeyin bool   `json:"enableKeyin"`
+		EnableLimit bool   `json:"enableLimit"`
+	}
+
+	StatusInfo struct {
+		Status   string          `json:"status"`
+		PageSucc uint64          `json:"pageSucc"`
+		PageFail uint64          `json:"pageFail"`
+		Spiders  []*app.Progress `json:"spiders"`
+		Summary  *app.Summary    `json:"summary,omitempty"`
+	}
+
+	server struct {
+		logic app.App
+		token string
+		mux   *http.ServeMux
+	}
+)
+
+/**
+  创建控制台的http.Handler
+  token不为空时，全部页面与接口均需认证：
+  以Basic认证的密码（用户名任意）或请求头 Authorization: Bearer <token> 提供
+*/
+func New(logic app.App, token string) http.Handler {
+	self := &server{
+		logic: logic,
+		token: token,
+		mux:   http.NewServeMux(),
+	}
+	self.mux.HandleFunc("/", self.index)
+	self.mux.HandleFunc("/api/spiders", self.spiders)
+	self.mux.HandleFunc("/api/outtypes", self.outTypes)
+	self.mux.HandleFunc("/api/task", self.task)
+	self.mux.HandleFunc("/api/pause", self.pause)
+	self.mux.HandleFunc("/api/resume", self.resume)
+	self.mux.HandleFunc("/api/stop", self.stop)
+	self.mux.HandleFunc("/api/status", self.status)
+	self.mux.Handle("/metrics", metrics.Handler())
+	return self
+}
+
+/**
+  启动控制台，阻塞运行
+  addr未指定主机时仅监听本机，需对外提供服务时应显式指定（如 0.0.0.0:9090）并设置token
+*/
+func Run(addr, token string, logic app.App) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+		addr = net.JoinHostPort(host, port)
+	}
+	if token == "" && !isLoopback(host) {
+		logs.Log.Warning(" *     控制台监听 %v 且未设置token，任何人均可启动或终止任务\n", addr)
+	}
+	logs.Log.Informational(" *     控制台已启动: http://%v\n", addr)
+	return http.ListenAndServe(addr, New(logic, token))
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (self *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !self.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="gospider"`)
+		writeError(w, http.StatusUnauthorized, "未认证")
+		return
+	}
+	self.mux.ServeHTTP(w, r)
+}
+
+func (self *server) authorized(r *http.Request) bool {
+	if self.token == "" {
+		return true
+	}
+	given := ""
+	if _, password, ok := r.BasicAuth(); ok {
+		given = password
+	} else if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		given = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(self.token)) == 1
+}
+
+func (self *server) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(dashboard))
+}
+
+func (self *server) spiders(w http.ResponseWriter, r *http.Request) {
+	list := []*SpiderInfo{}
+	for _, sp := range self.logic.GetSpiderLib() {
+		list = append(list, &SpiderInfo{
+			Name:        sp.GetName(),
+			Description: sp.GetDescription(),
+			EnableKeyin: sp.GetKeyin() == spider.KEYIN,
+			EnableLimit: sp.GetLimit() == spider.LIMIT,
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (self *server) outTypes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, collector.DataOutputLib)
+}
+
+func (self *server) task(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	form := &TaskForm{
+		ThreadNum:      20,
+		Pausetime:      300,
+		DockerCap:      10000,
+		SuccessInherit: true,
+		FailureInherit: true,
+	}
+	if err := json.NewDecoder(r.Body).Decode(form); err != nil {
+		writeError(w, http.StatusBadRequest, "参数格式错误: "+err.Error())
+		return
+	}
+
+	if form.OutType == "" && len(collector.DataOutputLib) > 0 {
+		form.OutType = collector.DataOutputLib[0]
+	}
+	if _, ok := collector.DataOutput[form.OutType]; !ok {
+		writeError(w, http.StatusBadRequest, "不支持的输出方式: "+form.OutType)
+		return
+	}
+	if len(form.Spiders) == 0 {
+		writeError(w, http.StatusBadRequest, "未指定蜘蛛")
+		return
+	}
+
+	var sps []*spider.Spider
+	for _, name := range form.Spiders {
+		sp := self.logic.GetSpiderByName(name)
+		if sp == nil {
+			writeError(w, http.StatusBadRequest, "蜘蛛不存在: "+name)
+			return
+		}
+		sps = append(sps, sp)
+	}
+
+	task := &cache.AppConf{
+		Mode:           status.OFFLINE,
+		ThreadNum:      form.ThreadNum,
+		Pausetime:      form.Pausetime,
+		OutType:        form.OutType,
+		DockerCap:      form.DockerCap,
+		Limit:          form.Limit,
+		ProxyMinute:    form.ProxyMinute,
+		SuccessInherit: form.SuccessInherit,
+		FailureInherit: form.FailureInherit,
+		Keyins:         form.Keyins,
+	}
+	if err := self.logic.SpiderPrepare(sps).Run(task); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	self.status(w, r)
+}
+
+func (self *server) pause(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	self.logic.Pause()
+	self.status(w, r)
+}
+
+func (self *server) resume(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	self.logic.Resume()
+	self.status(w, r)
+}
+
+//终止需等待各蜘蛛退出，异步执行
+func (self *server) stop(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	go self.logic.Stop()
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "stopping"})
+}
+
+func (self *server) status(w http.ResponseWriter, r *http.Request) {
+	info := &StatusInfo{
+		Status:   statusName(self.logic.Status()),
+		PageSucc: cache.GetPageCount(1),
+		PageFail: cache.GetPageCount(-1),
+		Spiders:  self.logic.Progress(),
+	}
+	if info.Status == "stopped" {
+		info.Summary = self.logic.LastSummary()
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func statusName(s int) string {
+	switch s {
+	case status.RUN:
+		return "running"
+	case status.PAUSE:
+		return "paused"
+	case status.STOP:
+		return "stopping"
+	default:
+		return "stopped"
+	}
+}
+
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "请使用POST方法")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}